@@ -0,0 +1,144 @@
+// Command netperf is the throughput server and client that the
+// pod-throughput check runs inside test pods, the prober of the egress check
+// and the don't-fragment pinger of the path-mtu check.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/netperf"
+)
+
+func main() {
+	root := &cobra.Command{
+		Use:          "netperf",
+		Short:        "Measure TCP and UDP throughput between two hosts",
+		SilenceUsage: true,
+	}
+
+	server := &cobra.Command{
+		Use:   "server",
+		Short: "Accept tests until interrupted",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			port, err := cmd.Flags().GetInt("port")
+			if err != nil {
+				return fmt.Errorf("failed to get port flag: %w", err)
+			}
+			s, err := netperf.Listen(net.JoinHostPort("", strconv.Itoa(port)))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "listening on %s\n", s.Addr())
+			return s.Serve(cmd.Context())
+		},
+	}
+	server.Flags().Int("port", netperf.DefaultPort, "TCP and UDP port to listen on")
+
+	client := &cobra.Command{
+		Use:   "client HOST",
+		Short: "Run one test against a server and print the result as JSON",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			port, err := flags.GetInt("port")
+			if err != nil {
+				return fmt.Errorf("failed to get port flag: %w", err)
+			}
+			opts := netperf.Options{Server: net.JoinHostPort(args[0], strconv.Itoa(port))}
+			if opts.Protocol, err = flags.GetString("protocol"); err != nil {
+				return fmt.Errorf("failed to get protocol flag: %w", err)
+			}
+			if opts.Duration, err = flags.GetDuration("duration"); err != nil {
+				return fmt.Errorf("failed to get duration flag: %w", err)
+			}
+			mbps, err := flags.GetFloat64("bandwidth")
+			if err != nil {
+				return fmt.Errorf("failed to get bandwidth flag: %w", err)
+			}
+			opts.Bandwidth = mbps * 1e6
+			if opts.DatagramSize, err = flags.GetInt("size"); err != nil {
+				return fmt.Errorf("failed to get size flag: %w", err)
+			}
+
+			result, err := netperf.Run(cmd.Context(), opts)
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(os.Stdout).Encode(result)
+		},
+	}
+	client.Flags().Int("port", netperf.DefaultPort, "Server port")
+	client.Flags().String("protocol", netperf.TCP, "Protocol to test, tcp or udp")
+	client.Flags().Duration("duration", 10*time.Second, "How long to send for")
+	client.Flags().Float64("bandwidth", 100, "UDP send rate in Mbit/s")
+	client.Flags().Int("size", netperf.DefaultDatagramSize, "UDP datagram size in bytes")
+
+	probe := &cobra.Command{
+		Use:   "probe TARGET...",
+		Short: "Probe URLs and host:port targets and print one JSON result per target",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			timeout, err := cmd.Flags().GetDuration("timeout")
+			if err != nil {
+				return fmt.Errorf("failed to get timeout flag: %w", err)
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			for _, target := range args {
+				if err := encoder.Encode(netperf.Probe(cmd.Context(), target, timeout)); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	probe.Flags().Duration("timeout", 10*time.Second, "Timeout per target")
+
+	ping := &cobra.Command{
+		Use:   "ping IP SIZE...",
+		Short: "Ping with each payload size and the don't-fragment bit set and print one JSON result per size",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			timeout, err := cmd.Flags().GetDuration("timeout")
+			if err != nil {
+				return fmt.Errorf("failed to get timeout flag: %w", err)
+			}
+			sizes := make([]int, len(args)-1)
+			for i, arg := range args[1:] {
+				if sizes[i], err = strconv.Atoi(arg); err != nil || sizes[i] < 0 {
+					return fmt.Errorf("invalid size %q", arg)
+				}
+			}
+			results, err := netperf.Ping(cmd.Context(), args[0], sizes, timeout)
+			if err != nil {
+				return err
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			for _, result := range results {
+				if err := encoder.Encode(result); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	ping.Flags().Duration("timeout", 2*time.Second, "Timeout per echo request")
+
+	root.AddCommand(server, client, probe, ping)
+	// Exit promptly when the pod is deleted.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := root.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(1)
+	}
+}
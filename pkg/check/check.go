@@ -0,0 +1,335 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/performance"
+	"github.com/denhamparry/kubernetes-testing/pkg/testrun"
+)
+
+// Status is the outcome of a single check run.
+type Status string
+
+const (
+	StatusPassed      Status = "passed"
+	StatusFailed      Status = "failed"
+	StatusSkipped     Status = "skipped"
+	StatusInterrupted Status = "interrupted"
+)
+
+// ErrInterrupted is the cancellation cause used when a run is stopped by a
+// signal. Checks cancelled with this cause are reported as interrupted rather
+// than failed.
+var ErrInterrupted = errors.New("interrupted")
+
+// Result is the structured outcome returned by a Check.
+type Result struct {
+	Status   Status
+	Message  string
+	Duration time.Duration
+	// Details is optional multi-line output, such as a connectivity matrix,
+	// shown below the message.
+	Details string
+}
+
+// cleanupTimeout bounds how long a single object deletion may take.
+const cleanupTimeout = 30 * time.Second
+
+// DefaultTimeout is how long checks wait for resources to become ready when
+// no timeout is configured.
+const DefaultTimeout = 60 * time.Second
+
+// Settings are the per-check parameters loaded from configs/tests/*.yaml.
+// Zero values mean the check should use its built-in default.
+type Settings struct {
+	Timeout      time.Duration
+	Replicas     int32
+	StorageClass string
+	Size         string
+	// ProbeFromHost makes checks of externally reachable services also
+	// send requests from the machine running ktest.
+	ProbeFromHost bool
+	// Lookups is how many operations each client of a benchmark sends.
+	Lookups int
+	// Thresholds are the limits a benchmark's metrics must stay within.
+	Thresholds performance.Thresholds
+	// Image replaces the default image of checks that run a test binary.
+	Image string
+	// Targets are the URLs and host:port pairs egress checks probe.
+	Targets []string
+	// Proxy is set in the environment of egress check pods.
+	Proxy Proxy
+}
+
+// Proxy is the HTTP proxy configuration of a pod, as the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY variables.
+type Proxy struct {
+	HTTP    string
+	HTTPS   string
+	NoProxy string
+}
+
+// Executor runs a command in a container, like `kubectl exec`. A command
+// that exits non-zero returns an error together with its output.
+type Executor interface {
+	Exec(ctx context.Context, namespace, pod, container string, command []string) (stdout, stderr string, err error)
+}
+
+// ExecFunc adapts a plain function to the Executor interface.
+type ExecFunc func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error)
+
+// Exec calls f.
+func (f ExecFunc) Exec(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+	return f(ctx, namespace, pod, container, command)
+}
+
+// Env carries the cluster handles and settings a check runs against.
+type Env struct {
+	Clientset kubernetes.Interface
+	// Dynamic reaches custom resources. Checks that need it skip when it is
+	// nil.
+	Dynamic dynamic.Interface
+	// Executor runs commands inside test pods. Checks that need it fail
+	// when it is nil.
+	Executor  Executor
+	Namespace string
+	// RunID identifies the ktest run; it is recorded on every test object.
+	RunID    string
+	Settings Settings
+	// KeepResources leaves test objects in place for debugging.
+	KeepResources bool
+
+	mu      sync.Mutex
+	notes   []string
+	details strings.Builder
+}
+
+// Timeout returns the configured wait timeout or DefaultTimeout.
+func (e *Env) Timeout() time.Duration {
+	if e.Settings.Timeout > 0 {
+		return e.Settings.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Name returns a unique object name made of prefix, the run ID and a random
+// suffix. Checks use it for every object they create so that neither checks
+// running in parallel nor concurrent runs against one cluster collide.
+func (e *Env) Name(prefix string) string {
+	if e.RunID == "" {
+		return fmt.Sprintf("%s-%s", prefix, utilrand.String(8))
+	}
+	return fmt.Sprintf("%s-%s-%s", prefix, e.RunID, utilrand.String(5))
+}
+
+// Selector returns labels selecting the pods of app created by this run. Use
+// it for selectors and include it in the matching pod labels, so that
+// selectors never match pods from another run.
+func (e *Env) Selector(app string) map[string]string {
+	selector := map[string]string{"app": app}
+	if e.RunID != "" {
+		selector[testrun.LabelRunID] = e.RunID
+	}
+	return selector
+}
+
+// Labels returns the labels every test object must carry so that leaked
+// objects can be found by `ktest cleanup`, merged with extra.
+func (e *Env) Labels(extra map[string]string) map[string]string {
+	labels := map[string]string{testrun.LabelManagedBy: testrun.ManagedByValue}
+	if e.RunID != "" {
+		labels[testrun.LabelRunID] = e.RunID
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+// Cleanup deletes a test object once a check is done with it, typically via
+// defer. del is given a fresh context so that cleanup still happens after the
+// check's context has expired. Failures are reported as warnings, and nothing
+// is deleted when KeepResources is set.
+func (e *Env) Cleanup(kind, name string, del func(ctx context.Context) error) {
+	if e.KeepResources {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := del(ctx); err != nil && !apierrors.IsNotFound(err) {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cleanup %s %s: %v\n", kind, name, err)
+	}
+}
+
+// Exec runs command in the first container of pod.
+func (e *Env) Exec(ctx context.Context, namespace, pod string, command ...string) (string, string, error) {
+	if e.Executor == nil {
+		return "", "", errors.New("exec into pods is not available")
+	}
+	return e.Executor.Exec(ctx, namespace, pod, "", command)
+}
+
+// Notef records a finding, such as a measured latency, that is included in
+// the check's result message.
+func (e *Env) Notef(format string, args ...interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.notes = append(e.notes, fmt.Sprintf(format, args...))
+}
+
+// Detailf appends a line to the check's result details, for output too
+// large for the message such as tables.
+func (e *Env) Detailf(format string, args ...interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprintf(&e.details, format, args...)
+	e.details.WriteString("\n")
+}
+
+// takeNotes returns and clears the notes and details recorded so far.
+func (e *Env) takeNotes() ([]string, string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	notes, details := e.notes, e.details.String()
+	e.notes = nil
+	e.details.Reset()
+	return notes, details
+}
+
+// Check is a single operational test that can be registered and run by ktest.
+type Check interface {
+	// Name uniquely identifies the check, e.g. "dns-resolution".
+	Name() string
+	// Category groups related checks, e.g. "networking".
+	Category() string
+	// Description is a short human readable summary of what is verified.
+	Description() string
+	// Run executes the check and reports its outcome.
+	Run(ctx context.Context, env *Env) Result
+}
+
+// Func is a plain test function that fails by returning an error.
+type Func func(ctx context.Context, env *Env) error
+
+// SkipError is returned by a Func that cannot run against the cluster, for
+// example because an optional component is not installed.
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string { return "skipped: " + e.Reason }
+
+// Skip returns an error that makes New report the check as skipped.
+func Skip(format string, args ...interface{}) error {
+	return &SkipError{Reason: fmt.Sprintf(format, args...)}
+}
+
+type funcCheck struct {
+	name        string
+	category    string
+	description string
+	fn          Func
+}
+
+// New adapts a Func to the Check interface. A nil error from fn is reported
+// as passed, a Skip error as skipped and any other error as failed with the
+// error as message. Notes recorded with Env.Notef are appended to the message
+// and output from Env.Detailf becomes the result's details.
+func New(name, category, description string, fn Func) Check {
+	return &funcCheck{
+		name:        name,
+		category:    category,
+		description: description,
+		fn:          fn,
+	}
+}
+
+func (c *funcCheck) Name() string        { return c.name }
+func (c *funcCheck) Category() string    { return c.category }
+func (c *funcCheck) Description() string { return c.description }
+
+func (c *funcCheck) Run(ctx context.Context, env *Env) Result {
+	env.takeNotes()
+	err := c.fn(ctx, env)
+	notes, details := env.takeNotes()
+
+	var skip *SkipError
+	result := Passed(strings.Join(notes, "; "))
+	if errors.As(err, &skip) {
+		result = Skipped("%s", skip.Reason)
+	} else if err != nil {
+		result = Failed(err)
+		if len(notes) > 0 {
+			result.Message += "; " + strings.Join(notes, "; ")
+		}
+	}
+	result.Details = details
+	return result
+}
+
+// Passed returns a passing result with an optional message.
+func Passed(message string) Result {
+	return Result{Status: StatusPassed, Message: message}
+}
+
+// Failed returns a failing result carrying the error text.
+func Failed(err error) Result {
+	return Result{Status: StatusFailed, Message: err.Error()}
+}
+
+// Skipped returns a skipped result with the reason the check did not run.
+func Skipped(format string, args ...interface{}) Result {
+	return Result{Status: StatusSkipped, Message: fmt.Sprintf(format, args...)}
+}
+
+// Interrupted returns the result for a check stopped by a signal.
+func Interrupted(message string) Result {
+	return Result{Status: StatusInterrupted, Message: message}
+}
+
+// Run executes c and records how long it took. A check that fails because
+// the run was interrupted is reported as interrupted.
+func Run(ctx context.Context, c Check, env *Env) Result {
+	start := time.Now()
+	result := c.Run(ctx, env)
+	if result.Status == StatusFailed && errors.Is(context.Cause(ctx), ErrInterrupted) {
+		result.Status = StatusInterrupted
+	}
+	if result.Duration == 0 {
+		result.Duration = time.Since(start)
+	}
+	return result
+}
+
+type criticalCheck struct {
+	Check
+}
+
+func (c criticalCheck) Critical() bool { return true }
+
+// Critical marks c as critical. Critical failures are what the operational
+// command gates on with --fail-on=critical.
+func Critical(c Check) Check {
+	return criticalCheck{Check: c}
+}
+
+// IsCritical reports whether c was marked critical. Checks may also opt in by
+// implementing a Critical() bool method.
+func IsCritical(c Check) bool {
+	if cc, ok := c.(interface{ Critical() bool }); ok {
+		return cc.Critical()
+	}
+	return false
+}
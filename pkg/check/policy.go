@@ -0,0 +1,40 @@
+package check
+
+import "fmt"
+
+// FailurePolicy decides which failed checks fail a run.
+type FailurePolicy string
+
+const (
+	// FailOnAny fails the run when any check fails.
+	FailOnAny FailurePolicy = "any"
+	// FailOnCritical fails the run only when a critical check fails.
+	FailOnCritical FailurePolicy = "critical"
+	// FailOnNever never fails the run because of check results.
+	FailOnNever FailurePolicy = "never"
+)
+
+// ParseFailurePolicy validates a --fail-on value.
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch p := FailurePolicy(s); p {
+	case FailOnAny, FailOnCritical, FailOnNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid failure policy: %s (must be 'any', 'critical' or 'never')", s)
+	}
+}
+
+// Fails reports whether a check with the given outcome fails the run.
+func (p FailurePolicy) Fails(result Result, critical bool) bool {
+	if result.Status != StatusFailed {
+		return false
+	}
+	switch p {
+	case FailOnAny:
+		return true
+	case FailOnCritical:
+		return critical
+	default:
+		return false
+	}
+}
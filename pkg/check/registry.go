@@ -0,0 +1,104 @@
+package check
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Registry holds checks in the order they were registered.
+type Registry struct {
+	mu     sync.RWMutex
+	checks []Check
+	names  map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// DefaultRegistry is the registry built-in and in-house checks register into.
+var DefaultRegistry = NewRegistry()
+
+// Register adds c to the registry. Check names must be unique.
+func (r *Registry) Register(c Check) error {
+	if c == nil {
+		return fmt.Errorf("check cannot be nil")
+	}
+	if c.Name() == "" {
+		return fmt.Errorf("check name cannot be empty")
+	}
+	if c.Category() == "" {
+		return fmt.Errorf("check %s has no category", c.Name())
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[c.Name()] {
+		return fmt.Errorf("check %s is already registered", c.Name())
+	}
+	r.names[c.Name()] = true
+	r.checks = append(r.checks, c)
+	return nil
+}
+
+// Checks returns every registered check in registration order.
+func (r *Registry) Checks() []Check {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	checks := make([]Check, len(r.checks))
+	copy(checks, r.checks)
+	return checks
+}
+
+// Get returns the check registered under name.
+func (r *Registry) Get(name string) (Check, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.checks {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Select returns the checks whose name or category matches one of filters.
+// The filter "all" matches every check. Checks are grouped by category, in
+// the order each category was first registered, and otherwise keep their
+// registration order.
+func (r *Registry) Select(filters []string) []Check {
+	wanted := map[string]bool{}
+	for _, f := range filters {
+		wanted[f] = true
+	}
+
+	var categories []string
+	byCategory := map[string][]Check{}
+	for _, c := range r.Checks() {
+		if _, ok := byCategory[c.Category()]; !ok {
+			categories = append(categories, c.Category())
+			byCategory[c.Category()] = nil
+		}
+		if wanted["all"] || wanted[c.Category()] || wanted[c.Name()] {
+			byCategory[c.Category()] = append(byCategory[c.Category()], c)
+		}
+	}
+
+	var selected []Check
+	for _, category := range categories {
+		selected = append(selected, byCategory[category]...)
+	}
+	return selected
+}
+
+// Register adds c to the DefaultRegistry. It is intended to be called from
+// package init functions and panics if the check cannot be registered.
+func Register(c Check) {
+	if err := DefaultRegistry.Register(c); err != nil {
+		panic(err)
+	}
+}
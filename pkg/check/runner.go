@@ -0,0 +1,119 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Runner runs a batch of checks.
+type Runner struct {
+	// Parallel is the maximum number of checks running at once.
+	Parallel int
+	// GracePeriod is how long running checks get to return, and run their
+	// cleanups, once the context is cancelled. Zero waits indefinitely.
+	GracePeriod time.Duration
+}
+
+// Run calls run for indexes 0..count-1 and returns the results in index
+// order, regardless of the order the calls finish in. done, if not nil, is
+// called as each call finishes; calls to done are serialised so it may write
+// progress without extra locking.
+//
+// Once ctx is cancelled no further calls are started, and calls that have
+// not returned by the end of the grace period are reported as interrupted,
+// or as failed when ctx ran out of time rather than being interrupted.
+func (r Runner) Run(ctx context.Context, count int, run func(ctx context.Context, i int) Result, done func(i int, result Result)) []Result {
+	parallel := r.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]Result, count)
+	finished := make([]bool, count)
+	var mu sync.Mutex
+	record := func(i int, result Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if finished[i] {
+			return
+		}
+		finished[i] = true
+		results[i] = result
+		if done != nil {
+			done(i, result)
+		}
+	}
+
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	started := 0
+	for ; started < count; started++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			record(i, run(ctx, i))
+		}(started)
+	}
+
+	for i := started; i < count; i++ {
+		record(i, notStarted(ctx))
+	}
+
+	allDone := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(allDone)
+	}()
+
+	select {
+	case <-allDone:
+	case <-ctx.Done():
+		var grace <-chan time.Time
+		if r.GracePeriod > 0 {
+			grace = time.After(r.GracePeriod)
+		}
+		select {
+		case <-allDone:
+		case <-grace:
+			for i := 0; i < count; i++ {
+				record(i, abandoned(ctx, r.GracePeriod))
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	out := make([]Result, count)
+	copy(out, results)
+	return out
+}
+
+func notStarted(ctx context.Context) Result {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrInterrupted) {
+		return Interrupted("not started")
+	}
+	return Failed(fmt.Errorf("not started: %w", cause))
+}
+
+func abandoned(ctx context.Context, grace time.Duration) Result {
+	message := fmt.Sprintf("still running %s after cancellation", grace)
+	cause := context.Cause(ctx)
+	if errors.Is(cause, ErrInterrupted) {
+		return Interrupted(message)
+	}
+	return Failed(fmt.Errorf("%s: %w", message, cause))
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/kubeconfig"
+	"github.com/denhamparry/kubernetes-testing/pkg/testrun"
+	"github.com/spf13/cobra"
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Delete test resources left behind by interrupted runs",
+	Long: `Find objects labelled as created by ktest and delete them. Select a single run
+with --run-id or everything older than a given age with --older-than. Use
+--dry-run to list what would be deleted.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kubeconfigPath, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return fmt.Errorf("failed to get kubeconfig flag: %w", err)
+		}
+		runID, err := cmd.Flags().GetString("run-id")
+		if err != nil {
+			return fmt.Errorf("failed to get run-id flag: %w", err)
+		}
+		olderThan, err := cmd.Flags().GetDuration("older-than")
+		if err != nil {
+			return fmt.Errorf("failed to get older-than flag: %w", err)
+		}
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			return fmt.Errorf("failed to get namespace flag: %w", err)
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return fmt.Errorf("failed to get dry-run flag: %w", err)
+		}
+
+		if runID == "" && olderThan <= 0 {
+			return fmt.Errorf("either --run-id or --older-than is required")
+		}
+		cmd.SilenceUsage = true
+
+		client, err := kubeconfig.NewClient(kubeconfigPath)
+		if err != nil {
+			return fmt.Errorf("failed to create kubernetes client: %w", err)
+		}
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), 5*time.Minute)
+		defer cancel()
+
+		resources, err := testrun.FindLeaked(ctx, client.Clientset, client.Dynamic, testrun.Filter{
+			RunID:     runID,
+			OlderThan: olderThan,
+			Namespace: namespace,
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(resources) == 0 {
+			fmt.Println("No leaked ktest resources found")
+			return nil
+		}
+
+		failed := 0
+		for _, r := range resources {
+			age := time.Since(r.Created).Round(time.Second)
+			if dryRun {
+				fmt.Printf("Would delete %s (run %s, age %s)\n", r, r.RunID, age)
+				continue
+			}
+			if err := testrun.Delete(ctx, client.Clientset, client.Dynamic, r); err != nil {
+				fmt.Printf("Failed to delete %s: %v\n", r, err)
+				failed++
+				continue
+			}
+			fmt.Printf("Deleted %s (run %s, age %s)\n", r, r.RunID, age)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("failed to delete %d of %d resources", failed, len(resources))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cleanupCmd)
+	cleanupCmd.Flags().String("run-id", "", "Only delete resources created by this run")
+	cleanupCmd.Flags().Duration("older-than", 0, "Only delete resources older than this (e.g. 1h)")
+	cleanupCmd.Flags().String("namespace", "", "Only search this namespace (default: all namespaces)")
+	cleanupCmd.Flags().Bool("dry-run", false, "List the resources that would be deleted without deleting them")
+}
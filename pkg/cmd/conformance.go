@@ -7,6 +7,7 @@ import (
 
 	"github.com/denhamparry/kubernetes-testing/pkg/conformance"
 	"github.com/denhamparry/kubernetes-testing/pkg/kubeconfig"
+	"github.com/denhamparry/kubernetes-testing/pkg/report"
 	"github.com/spf13/cobra"
 )
 
@@ -23,8 +24,13 @@ var conformanceCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to get mode flag: %w", err)
 		}
+		output, err := getOutputOptions(cmd)
+		if err != nil {
+			return err
+		}
+		out := output.progress()
 
-		fmt.Printf("Running conformance tests in %s mode...\n", mode)
+		fmt.Fprintf(out, "Running conformance tests in %s mode...\n", mode)
 
 		// Load kubeconfig and create client
 		client, err := kubeconfig.NewClient(kubeconfigPath)
@@ -38,8 +44,10 @@ var conformanceCmd = &cobra.Command{
 			return fmt.Errorf("failed to create conformance test: %w", err)
 		}
 
+		testReport := report.NewTestReport("Conformance")
+
 		// Run conformance test
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Minute)
 		defer cancel()
 		if err := test.Run(ctx, mode); err != nil {
 			return fmt.Errorf("conformance test failed: %w", err)
@@ -51,17 +59,45 @@ var conformanceCmd = &cobra.Command{
 			return fmt.Errorf("failed to get test results: %w", err)
 		}
 
-		fmt.Printf("Conformance test completed:\n")
-		fmt.Printf("  Status: %s\n", results.Status)
-		fmt.Printf("  Passed: %d\n", results.Passed)
-		fmt.Printf("  Failed: %d\n", results.Failed)
-		fmt.Printf("  Duration: %s\n", results.Duration)
+		fmt.Fprintf(out, "Conformance test completed:\n")
+		fmt.Fprintf(out, "  Status: %s\n", results.Status)
+		fmt.Fprintf(out, "  Passed: %d\n", results.Passed)
+		fmt.Fprintf(out, "  Failed: %d\n", results.Failed)
+		fmt.Fprintf(out, "  Duration: %s\n", results.Duration)
+
+		testReport.AddResult(conformanceResult(mode, results))
+		testReport.Complete()
 
-		return nil
+		return output.write(testReport)
 	},
 }
 
+// conformanceResult summarises Sonobuoy results as a single report entry.
+// Runs that have not produced any results yet are reported as skipped.
+func conformanceResult(mode string, results *conformance.Results) report.TestResult {
+	result := report.TestResult{
+		Name:     "conformance-" + mode,
+		Category: "conformance",
+		Duration: results.Duration,
+		Message:  results.Details,
+	}
+
+	switch {
+	case results.Failed > 0:
+		result.Status = "failed"
+		result.Message = fmt.Sprintf("%d of %d conformance tests failed", results.Failed, results.Passed+results.Failed)
+	case results.Passed > 0:
+		result.Status = "passed"
+		result.Message = fmt.Sprintf("%d conformance tests passed", results.Passed)
+	default:
+		result.Status = "skipped"
+	}
+
+	return result
+}
+
 func init() {
 	rootCmd.AddCommand(conformanceCmd)
 	conformanceCmd.Flags().String("mode", "quick", "Test mode: quick or certified-conformance")
+	addOutputFlags(conformanceCmd)
 }
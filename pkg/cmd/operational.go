@@ -2,16 +2,29 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/config"
 	"github.com/denhamparry/kubernetes-testing/pkg/kubeconfig"
-	"github.com/denhamparry/kubernetes-testing/pkg/networking"
-	"github.com/denhamparry/kubernetes-testing/pkg/storage"
-	"github.com/denhamparry/kubernetes-testing/pkg/workload"
+	"github.com/denhamparry/kubernetes-testing/pkg/report"
+	"github.com/denhamparry/kubernetes-testing/pkg/testrun"
 	"github.com/spf13/cobra"
+
+	// Register the built-in checks.
+	_ "github.com/denhamparry/kubernetes-testing/pkg/networking"
+	_ "github.com/denhamparry/kubernetes-testing/pkg/storage"
+	_ "github.com/denhamparry/kubernetes-testing/pkg/workload"
 )
 
+// namespaceDeleteTimeout bounds how long teardown waits for the ephemeral
+// namespace to be finalized.
+const namespaceDeleteTimeout = 2 * time.Minute
+
 var operationalCmd = &cobra.Command{
 	Use:   "operational",
 	Short: "Run operational tests",
@@ -29,8 +42,62 @@ var operationalCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to get namespace flag: %w", err)
 		}
+		keepNamespace, err := cmd.Flags().GetBool("keep-namespace")
+		if err != nil {
+			return fmt.Errorf("failed to get keep-namespace flag: %w", err)
+		}
+		configPaths, err := cmd.Flags().GetStringSlice("config")
+		if err != nil {
+			return fmt.Errorf("failed to get config flag: %w", err)
+		}
+		failOn, err := cmd.Flags().GetString("fail-on")
+		if err != nil {
+			return fmt.Errorf("failed to get fail-on flag: %w", err)
+		}
+		policy, err := check.ParseFailurePolicy(failOn)
+		if err != nil {
+			return err
+		}
+		parallel, err := cmd.Flags().GetInt("parallel")
+		if err != nil {
+			return fmt.Errorf("failed to get parallel flag: %w", err)
+		}
+		if parallel < 1 {
+			return fmt.Errorf("parallel must be at least 1")
+		}
+		gracePeriod, err := cmd.Flags().GetDuration("grace-period")
+		if err != nil {
+			return fmt.Errorf("failed to get grace-period flag: %w", err)
+		}
+		output, err := getOutputOptions(cmd)
+		if err != nil {
+			return err
+		}
+		out := output.progress()
+
+		var cfg *config.Config
+		if len(configPaths) > 0 {
+			cfg, err = config.Load(configPaths...)
+			if err != nil {
+				return fmt.Errorf("failed to load test config: %w", err)
+			}
+			for _, name := range cfg.Names() {
+				if _, ok := check.DefaultRegistry.Get(name); !ok {
+					fmt.Fprintf(out, "Warning: config entry %s does not match a registered check\n", name)
+				}
+			}
+		}
+
+		// Determine which tests to run
+		checks := check.DefaultRegistry.Select(tests)
+		if len(checks) == 0 {
+			return fmt.Errorf("no checks match %q", strings.Join(tests, ","))
+		}
 
-		fmt.Println("Running operational tests...")
+		// Flags are valid; from here on errors are not usage mistakes.
+		cmd.SilenceUsage = true
+
+		fmt.Fprintln(out, "Running operational tests...")
 
 		// Load kubeconfig and create client
 		client, err := kubeconfig.NewClient(kubeconfigPath)
@@ -38,85 +105,156 @@ var operationalCmd = &cobra.Command{
 			return fmt.Errorf("failed to create kubernetes client: %w", err)
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		ctx, cancel := context.WithTimeout(cmd.Context(), 10*time.Minute)
 		defer cancel()
 
-		// Determine which tests to run
-		runAll := contains(tests, "all")
-		runNetworking := runAll || contains(tests, "networking")
-		runStorage := runAll || contains(tests, "storage")
-		runWorkload := runAll || contains(tests, "workload")
-
-		// Run networking tests
-		if runNetworking {
-			fmt.Println("\nRunning networking tests...")
-			if err := networking.TestDNS(ctx, client.Clientset, namespace); err != nil {
-				fmt.Printf("  DNS test: FAILED - %v\n", err)
-			} else {
-				fmt.Println("  DNS test: PASSED")
-			}
+		// Every object is labelled with the run ID so that `ktest cleanup`
+		// can find anything an interrupted run leaves behind.
+		runID := testrun.NewID()
+		fmt.Fprintf(out, "Run ID: %s\n", runID)
 
-			if err := networking.TestPodCreation(ctx, client.Clientset, namespace); err != nil {
-				fmt.Printf("  Pod creation: FAILED - %v\n", err)
-			} else {
-				fmt.Println("  Pod creation: PASSED")
+		// Without an explicit namespace, every object goes into a namespace
+		// of its own that is deleted once the run is over.
+		if namespace == "" {
+			created, err := testrun.CreateNamespace(ctx, client.Clientset, runID)
+			if err != nil {
+				return err
 			}
+			namespace = created.Name
+			fmt.Fprintf(out, "Created namespace %s\n", namespace)
 
-			if err := networking.TestServiceConnectivity(ctx, client.Clientset, namespace); err != nil {
-				fmt.Printf("  Service connectivity: FAILED - %v\n", err)
-			} else {
-				fmt.Println("  Service connectivity: PASSED")
-			}
+			defer func() {
+				if keepNamespace {
+					fmt.Fprintf(out, "Keeping namespace %s (delete it with: kubectl delete namespace %s)\n", namespace, namespace)
+					return
+				}
+				fmt.Fprintf(out, "Deleting namespace %s...\n", namespace)
+				deleteCtx, cancel := context.WithTimeout(context.Background(), namespaceDeleteTimeout)
+				defer cancel()
+				if err := testrun.DeleteNamespace(deleteCtx, client.Clientset, namespace, namespaceDeleteTimeout); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+			}()
 		}
 
-		// Run storage tests
-		if runStorage {
-			fmt.Println("\nRunning storage tests...")
-			if err := storage.TestStorageClass(ctx, client.Clientset); err != nil {
-				fmt.Printf("  Storage class: FAILED - %v\n", err)
-			} else {
-				fmt.Println("  Storage class: PASSED")
-			}
+		testReport := report.NewTestReport("Operational")
+		var failed, gating int
+
+		if parallel > 1 {
+			fmt.Fprintf(out, "\nRunning %d checks, up to %d at a time...\n", len(checks), parallel)
+		}
+
+		testConfigs := make([]config.TestConfig, len(checks))
+		for i, c := range checks {
+			testConfigs[i], _ = cfg.Lookup(c.Name())
+		}
 
-			if err := storage.TestPVCCreation(ctx, client.Clientset, namespace, ""); err != nil {
-				fmt.Printf("  PVC creation: FAILED - %v\n", err)
-			} else {
-				fmt.Println("  PVC creation: PASSED")
+		run := func(ctx context.Context, i int) check.Result {
+			if !testConfigs[i].IsEnabled() {
+				return check.Skipped("disabled in config")
 			}
+			env := &check.Env{
+				Clientset:     client.Clientset,
+				Dynamic:       client.Dynamic,
+				Executor:      client,
+				Namespace:     namespace,
+				RunID:         runID,
+				Settings:      testConfigs[i].Settings(),
+				KeepResources: keepNamespace,
+			}
+			return check.Run(ctx, checks[i], env)
 		}
 
-		// Run workload tests
-		if runWorkload {
-			fmt.Println("\nRunning workload tests...")
-			if err := workload.TestDeployment(ctx, client.Clientset, namespace); err != nil {
-				fmt.Printf("  Deployment: FAILED - %v\n", err)
-			} else {
-				fmt.Println("  Deployment: PASSED")
+		category := ""
+		done := func(i int, result check.Result) {
+			c := checks[i]
+			name := c.Name()
+			if parallel > 1 {
+				name = c.Category() + "/" + name
+			} else if c.Category() != category {
+				category = c.Category()
+				fmt.Fprintf(out, "\nRunning %s tests...\n", category)
 			}
 
-			if err := workload.TestStatefulSet(ctx, client.Clientset, namespace); err != nil {
-				fmt.Printf("  StatefulSet: FAILED - %v\n", err)
-			} else {
-				fmt.Println("  StatefulSet: PASSED")
+			critical := testConfigs[i].IsCritical(check.IsCritical(c))
+			switch result.Status {
+			case check.StatusPassed:
+				if result.Message != "" {
+					fmt.Fprintf(out, "  %s: PASSED (%s) - %s\n", name, result.Duration.Round(time.Millisecond), result.Message)
+				} else {
+					fmt.Fprintf(out, "  %s: PASSED (%s)\n", name, result.Duration.Round(time.Millisecond))
+				}
+			case check.StatusSkipped:
+				fmt.Fprintf(out, "  %s: SKIPPED - %s\n", name, result.Message)
+			case check.StatusInterrupted:
+				fmt.Fprintf(out, "  %s: INTERRUPTED - %s\n", name, result.Message)
+			default:
+				failed++
+				label := "FAILED"
+				if critical {
+					label = "FAILED (critical)"
+				}
+				fmt.Fprintf(out, "  %s: %s - %s\n", name, label, result.Message)
+			}
+			if !output.showsDetails() {
+				for _, line := range report.DetailLines(result.Details) {
+					fmt.Fprintf(out, "    %s\n", line)
+				}
+			}
+			if policy.Fails(result, critical) {
+				gating++
 			}
 		}
 
-		fmt.Println("\nOperational tests completed!")
+		// Results come back in check order whatever order they finished in,
+		// so the report is deterministic.
+		runner := check.Runner{Parallel: parallel, GracePeriod: gracePeriod}
+		results := runner.Run(ctx, len(checks), run, done)
+		for i, result := range results {
+			testReport.AddResult(report.TestResult{
+				Name:     checks[i].Name(),
+				Category: checks[i].Category(),
+				Status:   string(result.Status),
+				Duration: result.Duration,
+				Message:  result.Message,
+				Details:  result.Details,
+			})
+		}
+		testReport.Complete()
+
+		interrupted := errors.Is(context.Cause(ctx), check.ErrInterrupted)
+		if interrupted {
+			fmt.Fprintf(out, "\nOperational tests interrupted (remove anything left behind with: ktest cleanup --run-id %s)\n", runID)
+		} else if failed == 0 {
+			fmt.Fprintln(out, "\nOperational tests completed!")
+		} else {
+			fmt.Fprintf(out, "\nOperational tests completed with %d of %d checks failed\n", failed, len(checks))
+		}
+		if err := output.write(testReport); err != nil {
+			return err
+		}
+
+		if interrupted {
+			return &exitError{code: ExitInterrupted, err: check.ErrInterrupted}
+		}
+		if gating > 0 {
+			return &exitError{
+				code: ExitChecksFailed,
+				err:  fmt.Errorf("%d failed checks violate the %q failure policy", gating, policy),
+			}
+		}
 		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(operationalCmd)
-	operationalCmd.Flags().StringSlice("tests", []string{"all"}, "Tests to run: networking, storage, workload, all")
-	operationalCmd.Flags().String("namespace", "default", "Kubernetes namespace to use for tests")
-}
-
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
-		}
-	}
-	return false
+	operationalCmd.Flags().StringSlice("tests", []string{"all"}, "Tests to run: a category (networking, storage, workload), a check name, or all")
+	operationalCmd.Flags().String("namespace", "", "Existing namespace to use for tests (default: a new namespace per run, deleted afterwards)")
+	operationalCmd.Flags().Bool("keep-namespace", false, "Keep the test namespace and objects after the run for debugging")
+	operationalCmd.Flags().StringSlice("config", nil, "Test config files or directories (e.g. configs/tests)")
+	operationalCmd.Flags().Int("parallel", 1, "Maximum number of checks to run at the same time")
+	operationalCmd.Flags().Duration("grace-period", 30*time.Second, "How long running checks get to stop and clean up after an interrupt")
+	operationalCmd.Flags().String("fail-on", string(check.FailOnAny), "Failures that give a non-zero exit code: any, critical or never")
+	addOutputFlags(operationalCmd)
 }
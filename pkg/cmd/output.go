@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+type outputOptions struct {
+	format string
+	file   string
+}
+
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().String("output-format", "text", fmt.Sprintf("Report format: %s", strings.Join(report.Formats, ", ")))
+	cmd.Flags().String("output-file", "", "Write the report to this file instead of stdout")
+}
+
+func getOutputOptions(cmd *cobra.Command) (outputOptions, error) {
+	format, err := cmd.Flags().GetString("output-format")
+	if err != nil {
+		return outputOptions{}, fmt.Errorf("failed to get output-format flag: %w", err)
+	}
+	file, err := cmd.Flags().GetString("output-file")
+	if err != nil {
+		return outputOptions{}, fmt.Errorf("failed to get output-file flag: %w", err)
+	}
+
+	supported := false
+	for _, f := range report.Formats {
+		if f == format {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return outputOptions{}, fmt.Errorf("invalid output format: %s (must be one of %s)", format, strings.Join(report.Formats, ", "))
+	}
+
+	return outputOptions{format: format, file: file}, nil
+}
+
+// progress returns where live progress lines should go. When a machine
+// readable report is written to stdout, progress moves to stderr so the
+// report can be piped.
+func (o outputOptions) progress() io.Writer {
+	if o.file == "" && o.format != "text" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// showsDetails reports whether the report is printed as text next to the
+// progress lines. Result details then appear in the report, and progress
+// leaves them out so that they are not printed twice.
+func (o outputOptions) showsDetails() bool {
+	return o.file == "" && o.format == "text"
+}
+
+func (o outputOptions) write(r *report.TestReport) error {
+	out, err := r.Render(o.format)
+	if err != nil {
+		return fmt.Errorf("failed to generate report: %w", err)
+	}
+
+	if o.file == "" {
+		fmt.Print(out)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(o.file), 0o755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := os.WriteFile(o.file, []byte(out), 0o644); err != nil {
+		return fmt.Errorf("failed to write report to %s: %w", o.file, err)
+	}
+	fmt.Fprintf(o.progress(), "Report written to %s\n", o.file)
+	return nil
+}
@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"time"
 
@@ -38,7 +37,7 @@ var performanceCmd = &cobra.Command{
 
 		// Create and run load test
 		loadTest := performance.NewLoadTest(duration, rps, endpoint)
-		ctx := context.Background()
+		ctx := cmd.Context()
 
 		metrics, err := loadTest.Run(ctx)
 		if err != nil {
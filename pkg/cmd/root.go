@@ -1,25 +1,82 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
 	"github.com/spf13/cobra"
 )
 
+// Exit codes returned by ktest.
+const (
+	// ExitPassed means every check that the failure policy gates on passed.
+	ExitPassed = 0
+	// ExitChecksFailed means the tests ran but checks failed.
+	ExitChecksFailed = 1
+	// ExitError means the tests could not be run, e.g. an invalid flag,
+	// kubeconfig or config file.
+	ExitError = 2
+	// ExitInterrupted means the run was stopped by SIGINT or SIGTERM.
+	ExitInterrupted = 130
+)
+
+// exitError carries a specific exit code out of a command.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
 var rootCmd = &cobra.Command{
-	Use:   "ktest",
-	Short: "Kubernetes cluster testing tool",
-	Long:  `A comprehensive testing tool for Kubernetes clusters including conformance, operational, and performance testing.`,
+	Use:           "ktest",
+	Short:         "Kubernetes cluster testing tool",
+	Long:          `A comprehensive testing tool for Kubernetes clusters including conformance, operational, and performance testing.`,
+	SilenceErrors: true,
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	ctx, cancel := signalContext()
+	defer cancel(nil)
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		os.Exit(ExitError)
 	}
 }
 
+// signalContext returns a context that is cancelled with check.ErrInterrupted
+// on the first SIGINT or SIGTERM, so that running checks stop and clean up.
+// A second signal terminates the process immediately.
+func signalContext() (context.Context, context.CancelCauseFunc) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(os.Stderr, "\nReceived %s, stopping checks and cleaning up (repeat to force quit)\n", sig)
+			cancel(check.ErrInterrupted)
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+
+	return ctx, cancel
+}
+
 func init() {
 	rootCmd.PersistentFlags().String("kubeconfig", "", "path to kubeconfig file (default: $HOME/.kube/config)")
 }
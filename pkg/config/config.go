@@ -0,0 +1,248 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/netperf"
+)
+
+// TestConfig is a single entry under "tests" in configs/tests/*.yaml.
+type TestConfig struct {
+	Name          string           `json:"name"`
+	Enabled       *bool            `json:"enabled,omitempty"`
+	Critical      *bool            `json:"critical,omitempty"`
+	Timeout       *metav1.Duration `json:"timeout,omitempty"`
+	Replicas      *int32           `json:"replicas,omitempty"`
+	StorageClass  string           `json:"storageClass,omitempty"`
+	Size          string           `json:"size,omitempty"`
+	ProbeFromHost bool             `json:"probeFromHost,omitempty"`
+	Lookups       *int32           `json:"lookups,omitempty"`
+	Thresholds    *Thresholds      `json:"thresholds,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	Targets       []string         `json:"targets,omitempty"`
+	Proxy         *Proxy           `json:"proxy,omitempty"`
+	Description   string           `json:"description,omitempty"`
+}
+
+// Thresholds are the limits a benchmark's results must stay within.
+type Thresholds struct {
+	P95Latency *metav1.Duration `json:"p95Latency,omitempty"`
+	P99Latency *metav1.Duration `json:"p99Latency,omitempty"`
+	// ErrorRate is a percentage.
+	ErrorRate *float64 `json:"errorRate,omitempty"`
+	// MinThroughput is in Gbit/s.
+	MinThroughput *float64 `json:"minThroughput,omitempty"`
+}
+
+// Proxy is the HTTP proxy egress checks send URL requests through.
+type Proxy struct {
+	HTTPProxy  string `json:"httpProxy,omitempty"`
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// NoProxy lists hosts, domains and CIDRs reached directly.
+	NoProxy string `json:"noProxy,omitempty"`
+}
+
+type file struct {
+	Tests []TestConfig `json:"tests"`
+}
+
+// Config is the merged set of test entries from one or more config files.
+type Config struct {
+	tests map[string]TestConfig
+	names []string
+}
+
+// Load parses each path, which may be a YAML file or a directory whose
+// *.yaml and *.yml files are all loaded. Test names must be unique across
+// every loaded file.
+func Load(paths ...string) (*Config, error) {
+	cfg := &Config{tests: map[string]TestConfig{}}
+
+	for _, path := range paths {
+		files, err := expand(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if err := cfg.loadFile(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+func expand(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(path, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list config directory %s: %w", path, err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config files found in %s", path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	var f file
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	for _, t := range f.Tests {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("invalid config %s: %w", path, err)
+		}
+		if _, ok := c.tests[t.Name]; ok {
+			return fmt.Errorf("invalid config %s: test %s is defined more than once", path, t.Name)
+		}
+		c.tests[t.Name] = t
+		c.names = append(c.names, t.Name)
+	}
+	return nil
+}
+
+func (t TestConfig) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("test name cannot be empty")
+	}
+	if t.Timeout != nil && t.Timeout.Duration <= 0 {
+		return fmt.Errorf("test %s: timeout must be greater than 0", t.Name)
+	}
+	if t.Replicas != nil && *t.Replicas <= 0 {
+		return fmt.Errorf("test %s: replicas must be greater than 0", t.Name)
+	}
+	if t.Lookups != nil && *t.Lookups <= 0 {
+		return fmt.Errorf("test %s: lookups must be greater than 0", t.Name)
+	}
+	if th := t.Thresholds; th != nil {
+		if (th.P95Latency != nil && th.P95Latency.Duration <= 0) || (th.P99Latency != nil && th.P99Latency.Duration <= 0) {
+			return fmt.Errorf("test %s: latency thresholds must be greater than 0", t.Name)
+		}
+		if th.ErrorRate != nil && (*th.ErrorRate <= 0 || *th.ErrorRate > 100) {
+			return fmt.Errorf("test %s: errorRate threshold must be a percentage greater than 0", t.Name)
+		}
+		if th.MinThroughput != nil && *th.MinThroughput <= 0 {
+			return fmt.Errorf("test %s: minThroughput threshold must be greater than 0", t.Name)
+		}
+	}
+	for _, target := range t.Targets {
+		if err := netperf.ValidateTarget(target); err != nil {
+			return fmt.Errorf("test %s: %w", t.Name, err)
+		}
+	}
+	if p := t.Proxy; p != nil {
+		for _, proxy := range []string{p.HTTPProxy, p.HTTPSProxy} {
+			if proxy == "" {
+				continue
+			}
+			u, err := url.Parse(proxy)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") || u.Host == "" {
+				return fmt.Errorf("test %s: invalid proxy %q: must be an http, https or socks5 URL", t.Name, proxy)
+			}
+		}
+	}
+	if t.Size != "" {
+		if _, err := resource.ParseQuantity(t.Size); err != nil {
+			return fmt.Errorf("test %s: invalid size %q: %w", t.Name, t.Size, err)
+		}
+	}
+	return nil
+}
+
+// Names returns the configured test names in the order they were loaded.
+func (c *Config) Names() []string {
+	names := make([]string, len(c.names))
+	copy(names, c.names)
+	return names
+}
+
+// Lookup returns the entry for the named test, if configured.
+func (c *Config) Lookup(name string) (TestConfig, bool) {
+	if c == nil {
+		return TestConfig{}, false
+	}
+	t, ok := c.tests[name]
+	return t, ok
+}
+
+// IsEnabled reports whether the test should run. Tests are enabled unless
+// explicitly disabled.
+func (t TestConfig) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// IsCritical reports whether failures of the test should fail the run under
+// --fail-on=critical, using fallback when the entry does not say.
+func (t TestConfig) IsCritical(fallback bool) bool {
+	if t.Critical == nil {
+		return fallback
+	}
+	return *t.Critical
+}
+
+// Settings converts the entry into the parameters passed to a check.
+func (t TestConfig) Settings() check.Settings {
+	settings := check.Settings{
+		StorageClass:  t.StorageClass,
+		Size:          t.Size,
+		ProbeFromHost: t.ProbeFromHost,
+		Image:         t.Image,
+		Targets:       t.Targets,
+	}
+	if t.Timeout != nil {
+		settings.Timeout = t.Timeout.Duration
+	}
+	if t.Replicas != nil {
+		settings.Replicas = *t.Replicas
+	}
+	if t.Lookups != nil {
+		settings.Lookups = int(*t.Lookups)
+	}
+	if th := t.Thresholds; th != nil {
+		if th.P95Latency != nil {
+			settings.Thresholds.P95Latency = th.P95Latency.Duration
+		}
+		if th.P99Latency != nil {
+			settings.Thresholds.P99Latency = th.P99Latency.Duration
+		}
+		if th.ErrorRate != nil {
+			settings.Thresholds.ErrorRate = *th.ErrorRate
+		}
+		if th.MinThroughput != nil {
+			settings.Thresholds.MinThroughput = *th.MinThroughput
+		}
+	}
+	if p := t.Proxy; p != nil {
+		settings.Proxy = check.Proxy{HTTP: p.HTTPProxy, HTTPS: p.HTTPSProxy, NoProxy: p.NoProxy}
+	}
+	return settings
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -12,7 +13,9 @@ import (
 
 type Client struct {
 	Clientset *kubernetes.Clientset
-	Config    *rest.Config
+	// Dynamic reaches resources without typed clients, such as CRDs.
+	Dynamic dynamic.Interface
+	Config  *rest.Config
 }
 
 func NewClient(kubeconfigPath string) (*Client, error) {
@@ -37,8 +40,14 @@ func NewClient(kubeconfigPath string) (*Client, error) {
 		return nil, fmt.Errorf("failed to create kubernetes clientset: %w", err)
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
 	return &Client{
 		Clientset: clientset,
+		Dynamic:   dynamicClient,
 		Config:    config,
 	}, nil
 }
@@ -0,0 +1,394 @@
+// Package netperf measures TCP and UDP throughput between two hosts. A
+// server accepts tests on one TCP and one UDP port; the client opens a TCP
+// control connection per test, streams data for a fixed duration and prints
+// the result as JSON. The ktest netperf image runs it inside test pods.
+package netperf
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultPort is the TCP and UDP port the server listens on.
+const DefaultPort = 5201
+
+const (
+	// tcpBufferSize is the size of each write of a TCP test.
+	tcpBufferSize = 128 << 10
+	// udpHeaderSize holds the test ID, sequence number and send time.
+	udpHeaderSize = 24
+	// DefaultDatagramSize fits a 1500 byte MTU with IPv6 and UDP headers.
+	DefaultDatagramSize = 1400
+	// udpDrainTime is how long the server waits for datagrams still in
+	// flight when a UDP test ends.
+	udpDrainTime = 500 * time.Millisecond
+	// resultTimeout bounds how long a client waits for a stalled send or
+	// for the result once the test duration is over.
+	resultTimeout = 10 * time.Second
+)
+
+// Protocols a test can use.
+const (
+	TCP = "tcp"
+	UDP = "udp"
+)
+
+// Result is the outcome of one test, as printed by the client.
+type Result struct {
+	Protocol string `json:"protocol"`
+	// Bytes is how many payload bytes the server received.
+	Bytes int64 `json:"bytes"`
+	// Seconds is how long the server was receiving.
+	Seconds float64 `json:"seconds"`
+	// BitsPerSecond is the received throughput.
+	BitsPerSecond float64 `json:"bitsPerSecond"`
+	// Retransmits is the number of TCP segments the client retransmitted,
+	// or -1 where the platform cannot tell.
+	Retransmits int64 `json:"retransmits,omitempty"`
+	// Packets, Lost and Jitter are only set for UDP. Jitter is the RFC 3550
+	// interarrival jitter.
+	Packets int64         `json:"packets,omitempty"`
+	Lost    int64         `json:"lost,omitempty"`
+	Jitter  time.Duration `json:"jitter,omitempty"`
+}
+
+// LossPercent returns the share of UDP datagrams lost.
+func (r *Result) LossPercent() float64 {
+	if r.Packets+r.Lost == 0 {
+		return 0
+	}
+	return float64(r.Lost) / float64(r.Packets+r.Lost) * 100
+}
+
+// Gbps returns the throughput in Gbit/s.
+func (r *Result) Gbps() float64 {
+	return r.BitsPerSecond / 1e9
+}
+
+// request starts a test on a control connection.
+type request struct {
+	Protocol string `json:"protocol"`
+	// ID tags the datagrams of a UDP test.
+	ID uint64 `json:"id,omitempty"`
+}
+
+// Server accepts tests on a TCP and a UDP socket bound to the same port.
+type Server struct {
+	tcp net.Listener
+	udp net.PacketConn
+
+	mu   sync.Mutex
+	udps map[uint64]*udpStats
+}
+
+// Listen binds the server to address, e.g. ":5201".
+func Listen(address string) (*Server, error) {
+	tcp, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on tcp %s: %w", address, err)
+	}
+	// Bind UDP to the port TCP got, in case address asked for any port.
+	host, _, _ := net.SplitHostPort(address)
+	port := tcp.Addr().(*net.TCPAddr).Port
+	udp, err := net.ListenPacket("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		tcp.Close()
+		return nil, fmt.Errorf("failed to listen on udp %s: %w", address, err)
+	}
+	return &Server{tcp: tcp, udp: udp, udps: map[uint64]*udpStats{}}, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.tcp.Addr()
+}
+
+// Serve runs tests until ctx is done.
+func (s *Server) Serve(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		s.tcp.Close()
+		s.udp.Close()
+	}()
+	go s.receiveDatagrams()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept: %w", err)
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return
+	}
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return
+	}
+
+	var result Result
+	switch req.Protocol {
+	case TCP:
+		// The client streams until it closes its side.
+		start := time.Now()
+		n, _ := io.Copy(io.Discard, reader)
+		result = Result{Bytes: n, Seconds: time.Since(start).Seconds()}
+	case UDP:
+		stats := &udpStats{}
+		s.mu.Lock()
+		s.udps[req.ID] = stats
+		s.mu.Unlock()
+		// Acknowledge so the client only sends once datagrams are counted,
+		// then wait for it to finish.
+		if _, err := conn.Write([]byte("ready\n")); err != nil {
+			return
+		}
+		if _, err := reader.ReadBytes('\n'); err != nil {
+			return
+		}
+		time.Sleep(udpDrainTime)
+		s.mu.Lock()
+		delete(s.udps, req.ID)
+		s.mu.Unlock()
+		result = stats.result()
+	default:
+		return
+	}
+	result.Protocol = req.Protocol
+	if result.Seconds > 0 {
+		result.BitsPerSecond = float64(result.Bytes) * 8 / result.Seconds
+	}
+	_ = json.NewEncoder(conn).Encode(result)
+}
+
+func (s *Server) receiveDatagrams() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, _, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n < udpHeaderSize {
+			continue
+		}
+		now := time.Now()
+		id := binary.BigEndian.Uint64(buf[0:])
+		s.mu.Lock()
+		stats := s.udps[id]
+		s.mu.Unlock()
+		if stats != nil {
+			stats.add(now, binary.BigEndian.Uint64(buf[8:]), int64(binary.BigEndian.Uint64(buf[16:])), n)
+		}
+	}
+}
+
+// udpStats accumulates the datagrams of one UDP test.
+type udpStats struct {
+	mu          sync.Mutex
+	first, last time.Time
+	packets     int64
+	bytes       int64
+	maxSeq      uint64
+	transit     time.Duration
+	jitter      float64
+}
+
+// add records a datagram with sequence number seq sent at sent (Unix
+// nanoseconds on the client clock). Clock offsets between the hosts cancel
+// out in the jitter, which only uses differences of transit times.
+func (u *udpStats) add(now time.Time, seq uint64, sent int64, size int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.packets == 0 {
+		u.first = now
+	} else {
+		d := now.Sub(time.Unix(0, sent)) - u.transit
+		if d < 0 {
+			d = -d
+		}
+		u.jitter += (float64(d) - u.jitter) / 16
+	}
+	u.transit = now.Sub(time.Unix(0, sent))
+	u.last = now
+	u.packets++
+	u.bytes += int64(size)
+	u.maxSeq = max(u.maxSeq, seq)
+}
+
+func (u *udpStats) result() Result {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	result := Result{Bytes: u.bytes, Packets: u.packets, Jitter: time.Duration(u.jitter)}
+	// Sequence numbers start at 1, so the highest one is how many were
+	// sent before the last datagram that arrived.
+	if lost := int64(u.maxSeq) - u.packets; lost > 0 {
+		result.Lost = lost
+	}
+	if u.packets > 1 {
+		result.Seconds = u.last.Sub(u.first).Seconds()
+	}
+	return result
+}
+
+// Options configure a client test.
+type Options struct {
+	// Server is the server's host:port.
+	Server   string
+	Protocol string
+	Duration time.Duration
+	// Bandwidth is the rate UDP datagrams are sent at in bits per second.
+	Bandwidth float64
+	// DatagramSize is the UDP payload size, DefaultDatagramSize if zero.
+	DatagramSize int
+}
+
+// Run runs one test against a server.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", opts.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", opts.Server, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var result *Result
+	switch opts.Protocol {
+	case TCP:
+		result, err = runTCP(conn.(*net.TCPConn), opts)
+	case UDP:
+		result, err = runUDP(ctx, conn, opts)
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", opts.Protocol)
+	}
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return result, err
+}
+
+func runTCP(conn *net.TCPConn, opts Options) (*Result, error) {
+	if err := json.NewEncoder(conn).Encode(request{Protocol: TCP}); err != nil {
+		return nil, fmt.Errorf("failed to start test: %w", err)
+	}
+	buf := make([]byte, tcpBufferSize)
+	deadline := time.Now().Add(opts.Duration)
+	if err := conn.SetDeadline(deadline.Add(resultTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+	for time.Now().Before(deadline) {
+		if _, err := conn.Write(buf); err != nil {
+			return nil, fmt.Errorf("failed to send: %w", err)
+		}
+	}
+	retransmits := retransmits(conn)
+	if err := conn.CloseWrite(); err != nil {
+		return nil, fmt.Errorf("failed to finish test: %w", err)
+	}
+	result, err := readResult(conn)
+	if err != nil {
+		return nil, err
+	}
+	result.Retransmits = retransmits
+	return result, nil
+}
+
+func runUDP(ctx context.Context, conn net.Conn, opts Options) (*Result, error) {
+	size := opts.DatagramSize
+	if size == 0 {
+		size = DefaultDatagramSize
+	}
+	if size < udpHeaderSize {
+		return nil, fmt.Errorf("datagram size must be at least %d bytes", udpHeaderSize)
+	}
+	if opts.Bandwidth <= 0 {
+		return nil, fmt.Errorf("bandwidth must be greater than 0")
+	}
+	// Datagrams are paced one interval apart, so the average rate matches
+	// the bandwidth.
+	interval := time.Duration(float64(size*8) / opts.Bandwidth * float64(time.Second))
+	if interval <= 0 {
+		return nil, fmt.Errorf("bandwidth %g bit/s is too high to pace %d byte datagrams", opts.Bandwidth, size)
+	}
+
+	host, port, err := net.SplitHostPort(opts.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server address %s: %w", opts.Server, err)
+	}
+	var dialer net.Dialer
+	udp, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to udp %s: %w", opts.Server, err)
+	}
+	defer udp.Close()
+
+	id := uint64(time.Now().UnixNano())
+	if err := json.NewEncoder(conn).Encode(request{Protocol: UDP, ID: id}); err != nil {
+		return nil, fmt.Errorf("failed to start test: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		return nil, fmt.Errorf("failed to start test: %w", err)
+	}
+
+	// Datagrams that are due after the scheduler slept too long are sent in
+	// a burst.
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint64(buf[0:], id)
+	start := time.Now()
+	var seq uint64
+	for time.Since(start) < opts.Duration {
+		due := uint64(time.Since(start)/interval) + 1
+		for ; seq < due; seq++ {
+			binary.BigEndian.PutUint64(buf[8:], seq+1)
+			binary.BigEndian.PutUint64(buf[16:], uint64(time.Now().UnixNano()))
+			// Send errors such as full buffers count as lost datagrams.
+			_, _ = udp.Write(buf)
+		}
+		time.Sleep(min(interval, time.Millisecond))
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(udpDrainTime + resultTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set deadline: %w", err)
+	}
+	if _, err := conn.Write([]byte("done\n")); err != nil {
+		return nil, fmt.Errorf("failed to finish test: %w", err)
+	}
+	result, err := readResult(reader)
+	if err != nil {
+		return nil, err
+	}
+	// The server cannot see datagrams lost after the last that arrived.
+	result.Lost = max(int64(seq)-result.Packets, 0)
+	return result, nil
+}
+
+func readResult(r io.Reader) (*Result, error) {
+	var result Result
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to read result: %w", err)
+	}
+	return &result, nil
+}
@@ -0,0 +1,174 @@
+package netperf
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// pingAttempts is how many echo requests are sent per size before it counts
+// as lost, so that a single dropped packet is not mistaken for an MTU limit.
+const pingAttempts = 2
+
+// PingResult is the outcome of pinging with one payload size, as printed by
+// the client.
+type PingResult struct {
+	// Size is the ICMP payload size in bytes, as for ping -s.
+	Size    int           `json:"size"`
+	Replied bool          `json:"replied"`
+	RTT     time.Duration `json:"rtt,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Ping sends ICMP echo requests to ip with each payload size in turn and
+// waits up to timeout for each reply. The requests have the don't-fragment
+// bit set and are never fragmented by the sender, so one larger than the
+// path MTU is lost or, once the kernel has learnt the path MTU, fails with
+// "message too long". It fails when no ICMP socket can be opened, for
+// example without permission.
+func Ping(ctx context.Context, ip string, sizes []int, timeout time.Duration) ([]PingResult, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid IP address %q", ip)
+	}
+	conn, dst, err := listenICMP(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	p := &pinger{conn: conn, dst: dst, timeout: timeout, id: os.Getpid() & 0xffff}
+	if addr.To4() != nil {
+		p.protocol, p.request, p.reply = 1, ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+		// Raw IPv4 sockets receive the IP header too.
+		_, p.ipHeader = dst.(*net.IPAddr)
+	} else {
+		p.protocol, p.request, p.reply = 58, ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+	// The token tells replies to this run apart from others the socket
+	// sees, since datagram sockets replace the echo ID.
+	p.token = make([]byte, 8)
+	if _, err := rand.Read(p.token); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	results := make([]PingResult, len(sizes))
+	for i, size := range sizes {
+		results[i] = PingResult{Size: size}
+		for attempt := 0; attempt < pingAttempts; attempt++ {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			rtt, err := p.echo(size)
+			if err == nil {
+				results[i].Replied, results[i].RTT, results[i].Error = true, rtt, ""
+				break
+			}
+			results[i].Error = err.Error()
+			if !errors.As(err, &lostError{}) {
+				// Send errors such as "message too long" do not go away.
+				break
+			}
+		}
+	}
+	return results, nil
+}
+
+// lostError means no reply arrived in time.
+type lostError struct {
+	timeout time.Duration
+}
+
+func (e lostError) Error() string { return fmt.Sprintf("no reply within %s", e.timeout) }
+
+// pinger sends echo requests on one ICMP socket.
+type pinger struct {
+	conn     net.PacketConn
+	dst      net.Addr
+	timeout  time.Duration
+	id       int
+	seq      int
+	token    []byte
+	protocol int
+	request  icmp.Type
+	reply    icmp.Type
+	ipHeader bool
+}
+
+// echo sends one request with size payload bytes and waits for its reply.
+func (p *pinger) echo(size int) (time.Duration, error) {
+	p.seq++
+	data := make([]byte, size)
+	copy(data, p.token)
+	markSeq(data, p.seq)
+	request := icmp.Message{
+		Type: p.request,
+		Body: &icmp.Echo{ID: p.id, Seq: p.seq & 0xffff, Data: data},
+	}
+	packet, err := request.Marshal(nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	start := time.Now()
+	if err := p.conn.SetDeadline(start.Add(p.timeout)); err != nil {
+		return 0, err
+	}
+	if _, err := p.conn.WriteTo(packet, p.dst); err != nil {
+		return 0, fmt.Errorf("failed to send: %w", unwrapOpError(err))
+	}
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return 0, lostError{timeout: p.timeout}
+			}
+			return 0, fmt.Errorf("failed to receive: %w", unwrapOpError(err))
+		}
+		received := buf[:n]
+		if p.ipHeader && n > 0 {
+			headerLen := int(received[0]&0x0f) * 4
+			if headerLen > n {
+				continue
+			}
+			received = received[headerLen:]
+		}
+		reply, err := icmp.ParseMessage(p.protocol, received)
+		if err != nil || reply.Type != p.reply {
+			continue
+		}
+		if echo, ok := reply.Body.(*icmp.Echo); ok && bytes.Equal(echo.Data, data) {
+			return time.Since(start), nil
+		}
+	}
+}
+
+// markSeq writes seq after the token where the payload has room, so that a
+// late reply to an earlier request of the same size is not matched.
+func markSeq(data []byte, seq int) {
+	for i := 0; i < 4 && 8+i < len(data); i++ {
+		data[8+i] = byte(seq >> (8 * i))
+	}
+}
+
+// unwrapOpError drops the operation and addresses net.OpError adds, leaving
+// the system error such as "message too long".
+func unwrapOpError(err error) error {
+	if op, ok := err.(*net.OpError); ok {
+		if sys, ok := op.Err.(*os.SyscallError); ok {
+			return sys.Err
+		}
+		return op.Err
+	}
+	return err
+}
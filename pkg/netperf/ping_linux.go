@@ -0,0 +1,49 @@
+//go:build linux
+
+package netperf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenICMP opens an ICMP socket for ip's family whose requests are never
+// fragmented: IP_PMTUDISC_DO sets the don't-fragment bit and makes sends
+// larger than the known path MTU fail. It prefers an unprivileged datagram
+// socket, which net.ipv4.ping_group_range must allow, and falls back to a
+// raw socket, which needs CAP_NET_RAW. dst is ip as an address of the
+// socket's type.
+func listenICMP(ip net.IP) (conn net.PacketConn, dst net.Addr, err error) {
+	family, protocol, level, option, value := unix.AF_INET, unix.IPPROTO_ICMP, unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_DO
+	if ip.To4() == nil {
+		family, protocol, level, option, value = unix.AF_INET6, unix.IPPROTO_ICMPV6, unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_DO
+	}
+
+	var errs []error
+	for _, sotype := range []int{unix.SOCK_DGRAM, unix.SOCK_RAW} {
+		fd, err := unix.Socket(family, sotype|unix.SOCK_CLOEXEC, protocol)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := unix.SetsockoptInt(fd, level, option, value); err != nil {
+			unix.Close(fd)
+			return nil, nil, fmt.Errorf("failed to set don't fragment: %w", err)
+		}
+		file := os.NewFile(uintptr(fd), "icmp")
+		conn, err := net.FilePacketConn(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open ICMP socket: %w", err)
+		}
+		if sotype == unix.SOCK_DGRAM {
+			return conn, &net.UDPAddr{IP: ip}, nil
+		}
+		return conn, &net.IPAddr{IP: ip}, nil
+	}
+	return nil, nil, fmt.Errorf("failed to open ICMP socket: %w", errors.Join(errs...))
+}
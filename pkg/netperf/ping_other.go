@@ -0,0 +1,14 @@
+//go:build !linux
+
+package netperf
+
+import (
+	"errors"
+	"net"
+)
+
+// listenICMP is only implemented on Linux, where the don't-fragment bit can
+// be set on ICMP sockets.
+func listenICMP(net.IP) (net.PacketConn, net.Addr, error) {
+	return nil, nil, errors.New("don't-fragment pings are only supported on Linux")
+}
@@ -0,0 +1,175 @@
+package netperf
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProbeResult is the outcome of probing one target, as printed by the
+// client. Phases that did not happen, such as DNS for an IP address or TLS
+// for plain HTTP, are zero.
+type ProbeResult struct {
+	Target    string        `json:"target"`
+	Reachable bool          `json:"reachable"`
+	DNS       time.Duration `json:"dns,omitempty"`
+	Connect   time.Duration `json:"connect,omitempty"`
+	TLS       time.Duration `json:"tls,omitempty"`
+	Total     time.Duration `json:"total"`
+	// Status is the HTTP status code of URL targets.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ValidateTarget checks that target is an http or https URL or a host:port.
+func ValidateTarget(target string) error {
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return fmt.Errorf("invalid URL %q: %w", target, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q: must be http or https with a host", target)
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil || host == "" || port == "" {
+		return fmt.Errorf("invalid target %q: must be a URL or host:port", target)
+	}
+	return nil
+}
+
+// Probe connects to target within timeout. A URL target is requested with
+// GET through any proxy set in the environment, and counts as reachable
+// when any HTTP response arrives, except a gateway error from the proxy,
+// which means the proxy could not reach the target. A host:port target only
+// needs a TCP connection.
+func Probe(ctx context.Context, target string, timeout time.Duration) *ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result := &ProbeResult{Target: target}
+	if err := ValidateTarget(target); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	var err error
+	if strings.Contains(target, "://") {
+		err = probeURL(ctx, target, result)
+	} else {
+		err = probeTCP(ctx, target, result)
+	}
+	result.Total = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Reachable = true
+	}
+	return result
+}
+
+func probeTCP(ctx context.Context, target string, result *ProbeResult) error {
+	host, port, _ := net.SplitHostPort(target)
+	addresses := []string{host}
+	if net.ParseIP(host) == nil {
+		start := time.Now()
+		var err error
+		addresses, err = net.DefaultResolver.LookupHost(ctx, host)
+		result.DNS = time.Since(start)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", host, err)
+		}
+	}
+
+	// Try the addresses in turn, as the HTTP client does.
+	var dialer net.Dialer
+	start := time.Now()
+	var err error
+	for _, address := range addresses {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, port)); err == nil {
+			result.Connect = time.Since(start)
+			return conn.Close()
+		}
+	}
+	result.Connect = time.Since(start)
+	return fmt.Errorf("failed to connect: %w", err)
+}
+
+func probeURL(ctx context.Context, target string, result *ProbeResult) error {
+	// Connects to several addresses may run in parallel; the connect time
+	// runs from the first start to the last completion.
+	var mu sync.Mutex
+	var dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { result.DNS = time.Since(dnsStart) },
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			defer mu.Unlock()
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(string, string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			result.Connect = time.Since(connectStart)
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { result.TLS = time.Since(tlsStart) },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	// A fresh transport so that every probe opens its own connection. The
+	// proxy settings are read for every probe, unlike
+	// http.ProxyFromEnvironment, which reads them once per process.
+	proxyFunc := httpproxy.FromEnvironment().ProxyFunc()
+	var proxy *url.URL
+	transport := &http.Transport{Proxy: func(r *http.Request) (*url.URL, error) {
+		var err error
+		proxy, err = proxyFunc(r.URL)
+		return proxy, err
+	}}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		// Redirects may leave the target, so the first response counts.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	result.Status = resp.StatusCode
+	if proxy != nil && gatewayError(resp.StatusCode) {
+		return fmt.Errorf("proxy %s answered %s", proxy.Redacted(), resp.Status)
+	}
+	return nil
+}
+
+// gatewayError reports whether status is one a proxy returns when it cannot
+// reach the upstream server.
+func gatewayError(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
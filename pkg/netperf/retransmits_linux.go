@@ -0,0 +1,25 @@
+//go:build linux
+
+package netperf
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// retransmits returns how many segments the connection retransmitted.
+func retransmits(conn *net.TCPConn) int64 {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return -1
+	}
+	var info *unix.TCPInfo
+	var infoErr error
+	if err := raw.Control(func(fd uintptr) {
+		info, infoErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	}); err != nil || infoErr != nil {
+		return -1
+	}
+	return int64(info.Total_retrans)
+}
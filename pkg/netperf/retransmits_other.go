@@ -0,0 +1,10 @@
+//go:build !linux
+
+package netperf
+
+import "net"
+
+// retransmits is only known on Linux.
+func retransmits(*net.TCPConn) int64 {
+	return -1
+}
@@ -0,0 +1,66 @@
+package networking
+
+import (
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const category = "networking"
+
+func init() {
+	check.Register(check.Critical(check.New("dns-resolution", category,
+		"Resolve the kubernetes service from a pod and compare the answer with its cluster IP", TestDNS)))
+	check.Register(check.New("dns-service-records", category,
+		"Resolve a service to its cluster IPs with A and AAAA queries", TestServiceRecords))
+	check.Register(check.New("dns-headless-records", category,
+		"Resolve a headless service and its per-pod records to pod IPs", TestHeadlessRecords))
+	check.Register(check.New("dns-srv-records", category,
+		"Look up the SRV record of a named service port", TestSRVRecords))
+	check.Register(check.New("dns-pod-hostname", category,
+		"Resolve a pod's hostname.subdomain record", TestPodHostnameRecords))
+	check.Register(check.New("dns-externalname", category,
+		"Look up the CNAME of an ExternalName service", TestExternalNameRecords))
+	check.Register(check.New("dns-search-path", category,
+		"Check the pod search path and resolve short service names", TestSearchPath))
+	check.Register(check.New("dns-external-lookup", category,
+		"Resolve a name outside the cluster", TestExternalLookup))
+	check.Register(check.New("dns-benchmark", category,
+		"Measure DNS lookup latency, timeouts and SERVFAIL answers from pods on several nodes", TestDNSBenchmark))
+	check.Register(check.Critical(check.New("pod-to-pod", category,
+		"Fetch a page from a server pod IP in a client pod", TestPodCreation)))
+	check.Register(check.New("cross-node-connectivity", category,
+		"Probe the pod and host network between every pair of nodes", TestNodeMatrix))
+	check.Register(check.New("host-network-pod", category,
+		"Reach a hostNetwork pod on its node IP from a regular pod", TestHostNetworkPod))
+	check.Register(check.New("host-port-pod", category,
+		"Reach a pod through its hostPort on the node IP from a regular pod", TestHostPortPod))
+	check.Register(check.New("host-network-dns", category,
+		"Resolve cluster DNS from a hostNetwork pod with dnsPolicy ClusterFirstWithHostNet", TestHostNetworkDNS))
+	check.Register(check.Critical(check.New("service-connectivity", category,
+		"Route requests through a ClusterIP service to every backend", TestServiceConnectivity)))
+	check.Register(check.New("service-hairpin", category,
+		"Reach a backend pod through its own service", TestServiceHairpin))
+	check.Register(check.New("service-session-affinity", category,
+		"Verify sessionAffinity ClientIP sends a client's requests to one backend", TestServiceSessionAffinity))
+	check.Register(check.New("service-internal-traffic-policy", category,
+		"Verify internalTrafficPolicy Local only routes to backends on the client's node", TestServiceInternalTrafficPolicy))
+	check.Register(check.New("service-external-traffic-policy", category,
+		"Verify externalTrafficPolicy Local node ports only forward to backends on their node", TestServiceExternalTrafficPolicy))
+	check.Register(check.New("dual-stack", category,
+		"Verify pods, services and traffic over both IPv4 and IPv6 on dual-stack clusters", TestDualStack))
+	check.Register(check.New("path-mtu", category,
+		"Send growing pings and payloads across nodes and through a service to find MTU blackholes", TestPathMTU))
+	check.Register(check.New("pod-throughput", category,
+		"Measure TCP throughput and UDP jitter and loss between pods on the same and different nodes", TestPodThroughput))
+	check.Register(check.New("nodeport-service", category,
+		"Reach a NodePort service on every node", TestNodePortService))
+	check.Register(check.New("loadbalancer-service", category,
+		"Reach a LoadBalancer service through its ingress address", TestLoadBalancerService))
+	check.Register(check.New("ingress", category,
+		"Route a host and path through an Ingress to two services", TestIngress))
+	check.Register(check.New("gateway-httproute", category,
+		"Route a host and path through a Gateway API HTTPRoute to two services", TestGatewayHTTPRoute))
+	check.Register(check.New("egress", category,
+		"Probe configured URLs and host:port targets from a pod with DNS, connect and TLS timing", TestEgress))
+	check.Register(check.New("network-policy", category,
+		"Verify NetworkPolicy ingress, egress and namespaceSelector rules are enforced", TestNetworkPolicy))
+}
@@ -7,129 +7,88 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
-	"k8s.io/client-go/kubernetes"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
 )
 
-// TestPodCreation tests the ability to create and delete multiple pods.
-// Note: This does NOT test actual pod-to-pod connectivity (exec/curl).
-// For real connectivity testing, see issue for implementing pod-to-pod communication tests.
-func TestPodCreation(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+// TestPodCreation starts an nginx server pod and a busybox client pod and
+// checks that the client can fetch a page from the server's pod IP. A failure
+// reports whether the request timed out, was refused or had no route.
+func TestPodCreation(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
 	if namespace == "" {
 		namespace = "default"
 	}
 
-	timestamp := time.Now().Unix()
-
 	// Create first pod (server)
-	serverPodName := fmt.Sprintf("connectivity-server-%d", timestamp)
+	serverPodName := env.Name("connectivity-server")
 	serverPod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      serverPodName,
 			Namespace: namespace,
-			Labels:    map[string]string{"app": "connectivity-test", "role": "server"},
+			Labels:    env.Labels(map[string]string{"app": "connectivity-test", "role": "server"}),
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
-					Name:    "server",
-					Image:   "nginx:alpine",
-					Ports:   []corev1.ContainerPort{{ContainerPort: 80}},
+					Name:  "server",
+					Image: serverImage,
+					Ports: []corev1.ContainerPort{{ContainerPort: 80}},
 				},
 			},
 		},
 	}
 
 	// Create second pod (client)
-	clientPodName := fmt.Sprintf("connectivity-client-%d", timestamp)
+	clientPodName := env.Name("connectivity-client")
 	clientPod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      clientPodName,
 			Namespace: namespace,
-			Labels:    map[string]string{"app": "connectivity-test", "role": "client"},
+			Labels:    env.Labels(map[string]string{"app": "connectivity-test", "role": "client"}),
 		},
 		Spec: corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
 					Name:    "client",
-					Image:   "busybox:latest",
+					Image:   clientImage,
 					Command: []string{"sh", "-c", "sleep 3600"},
 				},
 			},
 		},
 	}
 
-	// Create pods
+	// Create pods, cleaning each up once the test is done
 	_, err := clientset.CoreV1().Pods(namespace).Create(ctx, serverPod, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create server pod: %w", err)
 	}
+	defer env.Cleanup("pod", serverPodName, deletePod(env, namespace, serverPodName))
 
 	_, err = clientset.CoreV1().Pods(namespace).Create(ctx, clientPod, metav1.CreateOptions{})
 	if err != nil {
-		_ = clientset.CoreV1().Pods(namespace).Delete(ctx, serverPodName, metav1.DeleteOptions{})
 		return fmt.Errorf("failed to create client pod: %w", err)
 	}
+	defer env.Cleanup("pod", clientPodName, deletePod(env, namespace, clientPodName))
 
-	// Clean up pods
-	defer func() {
-		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := clientset.CoreV1().Pods(namespace).Delete(deleteCtx, serverPodName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Warning: failed to cleanup pod %s: %v\n", serverPodName, err)
-		}
-		if err := clientset.CoreV1().Pods(namespace).Delete(deleteCtx, clientPodName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Warning: failed to cleanup pod %s: %v\n", clientPodName, err)
-		}
-	}()
-
-	return nil
-}
-
-func TestServiceConnectivity(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
-	if namespace == "" {
-		namespace = "default"
+	server, err := waitForPodRunning(ctx, env, namespace, serverPodName)
+	if err != nil {
+		return err
 	}
-
-	timestamp := time.Now().Unix()
-	serviceName := fmt.Sprintf("test-service-%d", timestamp)
-
-	// Create service
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      serviceName,
-			Namespace: namespace,
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: map[string]string{"app": "test-service"},
-			Ports: []corev1.ServicePort{
-				{
-					Port:       80,
-					TargetPort: intstr.FromInt(80),
-				},
-			},
-		},
+	if server.Status.PodIP == "" {
+		return fmt.Errorf("server pod %s has no IP", serverPodName)
 	}
-
-	_, err := clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to create service: %w", err)
+	if _, err := waitForPodRunning(ctx, env, namespace, clientPodName); err != nil {
+		return err
 	}
 
-	// Clean up service
-	defer func() {
-		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := clientset.CoreV1().Services(namespace).Delete(deleteCtx, serviceName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Warning: failed to cleanup service %s: %v\n", serviceName, err)
-		}
-	}()
-
-	// Verify service was created
-	_, err = clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	url := httpURL(server.Status.PodIP, 80)
+	latency, err := probeHTTP(ctx, env, namespace, clientPodName, url)
 	if err != nil {
-		return fmt.Errorf("failed to verify service creation: %w", err)
+		return fmt.Errorf("client pod could not reach server pod: %w", err)
 	}
+	env.Notef("%s reachable in %s", url, latency.Round(time.Microsecond))
 
 	return nil
 }
@@ -3,71 +3,380 @@ package networking
 import (
 	"context"
 	"fmt"
-	"time"
+	"slices"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/kubernetes"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const (
+	// externalLookupName is resolved to check that the cluster DNS forwards
+	// names outside the cluster domain. The trailing dot skips the search
+	// path.
+	externalLookupName = "kubernetes.io."
+	// dnsServicePort is the named port of DNS test services.
+	dnsServicePort = "http"
+	// headlessBackends is how many pods back the headless test service.
+	headlessBackends = 2
 )
 
-func TestDNS(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+// TestDNS resolves the kubernetes Service from a pod and checks that the
+// answers are exactly the Service's cluster IPs, failing with the resolver
+// output when they differ.
+func TestDNS(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client, cleanup, err := startDNSClient(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	service, err := env.Clientset.CoreV1().Services(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the kubernetes service: %w", err)
+	}
+	name := client.serviceName("kubernetes", metav1.NamespaceDefault)
+	for _, ip := range clusterIPs(service) {
+		if _, err := client.expect(ctx, env, addressType(ip), name, ip); err != nil {
+			return err
+		}
+		env.Notef("%s %s resolved to %s", name, addressType(ip), ip)
+	}
+
+	return nil
+}
+
+// TestServiceRecords creates a ClusterIP service, dual-stack where the
+// cluster supports it, and checks that its name resolves to every cluster IP
+// with A and AAAA queries.
+func TestServiceRecords(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client, cleanup, err := startDNSClient(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	preferDualStack := corev1.IPFamilyPolicyPreferDualStack
+	service, deleteService, err := createDNSService(ctx, env, namespace, env.Name("dns-service"), func(spec *corev1.ServiceSpec) {
+		spec.IPFamilyPolicy = &preferDualStack
+	})
+	if err != nil {
+		return err
+	}
+	defer deleteService()
+
+	name := client.serviceName(service.Name, namespace)
+	for _, ip := range clusterIPs(service) {
+		if _, err := client.expect(ctx, env, addressType(ip), name, ip); err != nil {
+			return err
+		}
+		env.Notef("%s resolved to %s", addressType(ip), ip)
+	}
+
+	return nil
+}
+
+// TestHeadlessRecords creates a headless service with backend pods and checks
+// that the service name resolves to every pod IP and that each endpoint has
+// its own record, named after its IP as CoreDNS does.
+func TestHeadlessRecords(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client, cleanup, err := startDNSClient(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	selector := env.Selector("dns-headless")
+	service, deleteService, err := createDNSService(ctx, env, namespace, env.Name("dns-headless"), func(spec *corev1.ServiceSpec) {
+		spec.ClusterIP = corev1.ClusterIPNone
+		spec.Selector = selector
+	})
+	if err != nil {
+		return err
+	}
+	defer deleteService()
+
+	pods := make([]*corev1.Pod, headlessBackends)
+	for i := range pods {
+		pods[i] = newServerPod(env, namespace, env.Name("dns-headless-backend"), selector)
+	}
+	deletePods, err := createPods(ctx, env, pods...)
+	defer deletePods()
+	if err != nil {
+		return err
+	}
+	ips := make([]string, len(pods))
+	for i, pod := range pods {
+		running, err := waitForPodRunning(ctx, env, namespace, pod.Name)
+		if err != nil {
+			return err
+		}
+		ips[i] = running.Status.PodIP
+	}
+
+	name := client.serviceName(service.Name, namespace)
+	qtype := addressType(ips[0])
+	if _, err := client.expect(ctx, env, qtype, name, ips...); err != nil {
+		return err
+	}
+	env.Notef("%s resolved to %d pod IPs", name, len(ips))
+
+	dashes := strings.NewReplacer(".", "-", ":", "-")
+	for _, ip := range ips {
+		podName := dashes.Replace(ip) + "." + name
+		if _, err := client.expect(ctx, env, qtype, podName, ip); err != nil {
+			return err
+		}
+	}
+	env.Notef("%d per-pod records", len(ips))
+
+	return nil
+}
+
+// TestSRVRecords creates a service with a named port and checks the SRV
+// record for it points at the service name and port.
+func TestSRVRecords(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client, cleanup, err := startDNSClient(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	service, deleteService, err := createDNSService(ctx, env, namespace, env.Name("dns-srv"), nil)
+	if err != nil {
+		return err
+	}
+	defer deleteService()
+
+	target := client.serviceName(service.Name, namespace)
+	port := service.Spec.Ports[0]
+	name := fmt.Sprintf("_%s._%s.%s", port.Name, strings.ToLower(string(port.Protocol)), target)
+	if _, err := client.expect(ctx, env, "SRV", name, fmt.Sprintf("%d %s", port.Port, target)); err != nil {
+		return err
+	}
+	env.Notef("%s points at %s:%d", name, target, port.Port)
+
+	return nil
+}
+
+// TestPodHostnameRecords starts a pod with a hostname and a subdomain matching
+// a headless service and checks that hostname.subdomain resolves to the pod.
+func TestPodHostnameRecords(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
 	if namespace == "" {
 		namespace = "default"
 	}
 
-	// Create a test pod for DNS resolution
-	podName := "dns-test-" + fmt.Sprintf("%d", time.Now().Unix())
-	pod := &corev1.Pod{
+	client, cleanup, err := startDNSClient(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	selector := env.Selector("dns-subdomain")
+	service, deleteService, err := createDNSService(ctx, env, namespace, env.Name("dns-subdomain"), func(spec *corev1.ServiceSpec) {
+		spec.ClusterIP = corev1.ClusterIPNone
+		spec.Selector = selector
+	})
+	if err != nil {
+		return err
+	}
+	defer deleteService()
+
+	pod := newServerPod(env, namespace, env.Name("dns-hostname"), selector)
+	pod.Spec.Hostname = pod.Name
+	pod.Spec.Subdomain = service.Name
+	deletePods, err := createPods(ctx, env, pod)
+	defer deletePods()
+	if err != nil {
+		return err
+	}
+	running, err := waitForPodRunning(ctx, env, namespace, pod.Name)
+	if err != nil {
+		return err
+	}
+
+	ip := running.Status.PodIP
+	name := pod.Spec.Hostname + "." + client.serviceName(service.Name, namespace)
+	if _, err := client.expect(ctx, env, addressType(ip), name, ip); err != nil {
+		return err
+	}
+	env.Notef("%s resolved to %s", name, ip)
+
+	return nil
+}
+
+// TestExternalNameRecords creates an ExternalName service pointing at the
+// kubernetes Service and checks that its name is a CNAME for the target.
+func TestExternalNameRecords(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client, cleanup, err := startDNSClient(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	target := client.serviceName("kubernetes", metav1.NamespaceDefault)
+	service, deleteService, err := createDNSService(ctx, env, namespace, env.Name("dns-externalname"), func(spec *corev1.ServiceSpec) {
+		spec.Type = corev1.ServiceTypeExternalName
+		spec.ExternalName = target
+		spec.Ports = nil
+	})
+	if err != nil {
+		return err
+	}
+	defer deleteService()
+
+	name := client.serviceName(service.Name, namespace)
+	if _, err := client.expect(ctx, env, "CNAME", name, target); err != nil {
+		return err
+	}
+	env.Notef("%s is a CNAME for %s", name, target)
+
+	return nil
+}
+
+// TestSearchPath checks that pods get the cluster search path in
+// /etc/resolv.conf and that short service names are expanded with it: the
+// bare name of a service in the pod's namespace, and service.namespace.
+func TestSearchPath(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client, cleanup, err := startDNSClient(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	want := []string{namespace + ".svc." + client.domain, "svc." + client.domain, client.domain}
+	if len(client.conf.search) < len(want) || !slices.Equal(client.conf.search[:len(want)], want) {
+		return fmt.Errorf("search path is %q, expected it to start with %q",
+			strings.Join(client.conf.search, " "), strings.Join(want, " "))
+	}
+	env.Notef("search %s, ndots %d", strings.Join(client.conf.search, " "), client.conf.ndots)
+
+	local, deleteService, err := createDNSService(ctx, env, namespace, env.Name("dns-search"), nil)
+	if err != nil {
+		return err
+	}
+	defer deleteService()
+	kubernetes, err := env.Clientset.CoreV1().Services(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the kubernetes service: %w", err)
+	}
+
+	for _, short := range []struct {
+		name    string
+		service *corev1.Service
+	}{
+		{local.Name, local},
+		{"kubernetes." + metav1.NamespaceDefault, kubernetes},
+	} {
+		ip := clusterIPs(short.service)[0]
+		if _, err := client.expect(ctx, env, addressType(ip), short.name, ip); err != nil {
+			return err
+		}
+		env.Notef("%s expanded", short.name)
+	}
+
+	return nil
+}
+
+// TestExternalLookup checks that the cluster DNS resolves a name outside the
+// cluster, which requires it to forward queries upstream.
+func TestExternalLookup(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client, cleanup, err := startDNSClient(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	records, err := client.expect(ctx, env, "A", externalLookupName)
+	if err != nil {
+		return err
+	}
+	addresses := make([]string, len(records))
+	for i, record := range records {
+		addresses[i] = record.Value
+	}
+	env.Notef("%s resolved to %s", strings.TrimSuffix(externalLookupName, "."), strings.Join(addresses, ", "))
+
+	return nil
+}
+
+// createDNSService creates a selectorless ClusterIP service with one named
+// port, changed by configure. The returned func deletes it.
+func createDNSService(ctx context.Context, env *check.Env, namespace, name string, configure func(*corev1.ServiceSpec)) (*corev1.Service, func(), error) {
+	clientset := env.Clientset
+	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      podName,
+			Name:      name,
 			Namespace: namespace,
+			Labels:    env.Labels(nil),
 		},
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
 				{
-					Name:    "dns-test",
-					Image:   "busybox:latest",
-					Command: []string{"sh", "-c", "nslookup kubernetes.default && sleep 3600"},
+					Name:     dnsServicePort,
+					Protocol: corev1.ProtocolTCP,
+					Port:     80,
 				},
 			},
-			RestartPolicy: corev1.RestartPolicyNever,
 		},
 	}
-
-	// Create the pod
-	_, err := clientset.CoreV1().Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to create DNS test pod: %w", err)
+	if configure != nil {
+		configure(&service.Spec)
 	}
 
-	// Clean up pod on completion
-	defer func() {
-		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := clientset.CoreV1().Pods(namespace).Delete(deleteCtx, podName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Warning: failed to cleanup pod %s: %v\n", podName, err)
-		}
-	}()
-
-	// Wait for pod to complete using proper wait mechanism
-	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, 60*time.Second, true,
-		func(ctx context.Context) (bool, error) {
-			pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
-			if err != nil {
-				return false, err
-			}
-			if pod.Status.Phase == corev1.PodSucceeded {
-				return true, nil
-			}
-			if pod.Status.Phase == corev1.PodFailed {
-				return false, fmt.Errorf("DNS test pod failed")
-			}
-			return false, nil
-		})
+	service, err := clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
 	if err != nil {
-		return fmt.Errorf("DNS test failed: %w", err)
+		return nil, nil, fmt.Errorf("failed to create service: %w", err)
 	}
+	return service, func() {
+		env.Cleanup("service", name, func(ctx context.Context) error {
+			return clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		})
+	}, nil
+}
 
-	return nil
+// clusterIPs returns the service's cluster IPs, primary first.
+func clusterIPs(service *corev1.Service) []string {
+	if len(service.Spec.ClusterIPs) > 0 {
+		return service.Spec.ClusterIPs
+	}
+	return []string{service.Spec.ClusterIP}
 }
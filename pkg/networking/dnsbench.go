@@ -0,0 +1,256 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/performance"
+)
+
+const (
+	// defaultDNSClients is how many client pods send lookups when no
+	// replicas are configured.
+	defaultDNSClients = 3
+	// defaultLookups is how many lookups each client sends when none are
+	// configured.
+	defaultLookups = 200
+)
+
+// defaultDNSThresholds catch the five second stalls of lost DNS packets,
+// such as conntrack races, which resolvers only recover from by retrying.
+var defaultDNSThresholds = performance.Thresholds{
+	P99Latency: time.Second,
+	ErrorRate:  1,
+}
+
+// lookupSample is the outcome of a single benchmark lookup.
+type lookupSample struct {
+	latency time.Duration
+	// failure is empty for answered lookups, else ReasonTimeout,
+	// "SERVFAIL" or ReasonFailed.
+	failure string
+}
+
+// dnsClientStats are the samples of one client pod.
+type dnsClientStats struct {
+	node    string
+	samples []lookupSample
+}
+
+// TestDNSBenchmark starts client pods spread across nodes and has each send
+// a number of lookups for the kubernetes Service back to back. It reports
+// latency percentiles and the rate of timeouts and SERVFAIL answers, overall
+// and per node, and fails when the configured thresholds are exceeded.
+func TestDNSBenchmark(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	clients := int(env.Settings.Replicas)
+	if clients <= 0 {
+		clients = defaultDNSClients
+	}
+	lookups := env.Settings.Lookups
+	if lookups <= 0 {
+		lookups = defaultLookups
+	}
+	// Unset thresholds keep their defaults.
+	thresholds := env.Settings.Thresholds
+	if thresholds.P95Latency == 0 {
+		thresholds.P95Latency = defaultDNSThresholds.P95Latency
+	}
+	if thresholds.P99Latency == 0 {
+		thresholds.P99Latency = defaultDNSThresholds.P99Latency
+	}
+	if thresholds.ErrorRate == 0 {
+		thresholds.ErrorRate = defaultDNSThresholds.ErrorRate
+	}
+
+	// Spread the clients across nodes where possible.
+	selector := env.Selector("dns-benchmark")
+	pods := make([]*corev1.Pod, clients)
+	for i := range pods {
+		pods[i] = newClientPod(env, namespace, env.Name("dns-benchmark"), selector)
+		pods[i].Spec.Affinity = &corev1.Affinity{
+			PodAntiAffinity: &corev1.PodAntiAffinity{
+				PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+					{
+						Weight: 100,
+						PodAffinityTerm: corev1.PodAffinityTerm{
+							LabelSelector: &metav1.LabelSelector{MatchLabels: selector},
+							TopologyKey:   corev1.LabelHostname,
+						},
+					},
+				},
+			},
+		}
+	}
+	deletePods, err := createPods(ctx, env, pods...)
+	defer deletePods()
+	if err != nil {
+		return err
+	}
+	nodes := make([]string, len(pods))
+	for i, pod := range pods {
+		running, err := waitForPodRunning(ctx, env, namespace, pod.Name)
+		if err != nil {
+			return err
+		}
+		nodes[i] = running.Spec.NodeName
+	}
+
+	conf, err := readResolvConf(ctx, env, namespace, pods[0].Name)
+	if err != nil {
+		return err
+	}
+	// The trailing dot sends exactly one query per lookup.
+	name := "kubernetes.default.svc." + conf.clusterDomain(namespace) + "."
+
+	lookupCtx, cancel := context.WithTimeout(ctx, env.Timeout())
+	defer cancel()
+	start := time.Now()
+	stats := make([]dnsClientStats, len(pods))
+	errs := make(chan error, len(pods))
+	var wg sync.WaitGroup
+	for i, pod := range pods {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			samples, err := benchmarkLookups(lookupCtx, env, namespace, pod.Name, name, lookups)
+			if err != nil {
+				errs <- err
+				return
+			}
+			stats[i] = dnsClientStats{node: nodes[i], samples: samples}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		if lookupCtx.Err() != nil && ctx.Err() == nil {
+			return fmt.Errorf("%d lookups per pod did not finish within %s", lookups, env.Timeout())
+		}
+		return err
+	}
+
+	var all []lookupSample
+	for _, s := range stats {
+		all = append(all, s.samples...)
+	}
+	metrics, timeouts, servfails := summarizeLookups(time.Since(start), all)
+
+	env.Detailf("%s", strings.TrimSpace(metrics.Report()))
+	env.Detailf("Timeouts:         %d (%.2f%%)", timeouts, percent(timeouts, len(all)))
+	env.Detailf("SERVFAIL:         %d (%.2f%%)", servfails, percent(servfails, len(all)))
+	env.Detailf("")
+	env.Detailf("Per node:")
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].node < stats[j].node })
+	for _, s := range stats {
+		m, t, f := summarizeLookups(0, s.samples)
+		env.Detailf("  %-24s %d lookups, p50 %s, p99 %s, %d timeouts, %d SERVFAIL",
+			s.node, m.TotalRequests, m.P50Latency.Round(time.Microsecond), m.P99Latency.Round(time.Microsecond), t, f)
+	}
+
+	env.Notef("%d lookups from %d pods: p50 %s, p95 %s, p99 %s, %.2f%% timeouts, %.2f%% SERVFAIL",
+		len(all), len(pods), metrics.P50Latency.Round(time.Microsecond), metrics.P95Latency.Round(time.Microsecond),
+		metrics.P99Latency.Round(time.Microsecond), percent(timeouts, len(all)), percent(servfails, len(all)))
+	if exceeded := metrics.Exceeded(thresholds); len(exceeded) > 0 {
+		return fmt.Errorf("DNS thresholds exceeded: %s", strings.Join(exceeded, ", "))
+	}
+
+	return nil
+}
+
+// benchmarkLookups runs count back-to-back A lookups of name in the pod in a
+// single exec. Each lookup prints "rc nanoseconds output"; the latency
+// includes starting nslookup.
+func benchmarkLookups(ctx context.Context, env *check.Env, namespace, pod, name string, count int) ([]lookupSample, error) {
+	script := fmt.Sprintf(`for i in $(seq %d); do start=$(date +%%s%%N); out=$(nslookup -type=a '%s' 2>&1); rc=$?; end=$(date +%%s%%N); echo "$rc $((end-start)) $(echo "$out" | tr '\n' ' ')"; done`,
+		count, name)
+	stdout, stderr, err := env.Exec(ctx, namespace, pod, "sh", "-c", script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exec in pod %s: %w (%s)", pod, err, strings.TrimSpace(stderr))
+	}
+
+	var samples []lookupSample
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		nanos, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected lookup output in pod %s: %q", pod, line)
+		}
+		output := ""
+		if len(fields) == 3 {
+			output = fields[2]
+		}
+		samples = append(samples, lookupSample{
+			latency: time.Duration(nanos),
+			failure: classifyLookup(fields[0], output),
+		})
+	}
+	if len(samples) != count {
+		return nil, fmt.Errorf("pod %s reported %d of %d lookups", pod, len(samples), count)
+	}
+	return samples, nil
+}
+
+// classifyLookup returns why a lookup failed from nslookup's exit code and
+// output, or "" when it was answered.
+func classifyLookup(rc, output string) string {
+	switch {
+	case rc == "0" && strings.Contains(output, "Name:"):
+		return ""
+	case strings.Contains(output, "SERVFAIL"):
+		return "SERVFAIL"
+	case strings.Contains(output, "timed out"), strings.Contains(output, "no servers could be reached"):
+		return ReasonTimeout
+	default:
+		return ReasonFailed
+	}
+}
+
+// summarizeLookups returns the metrics of samples, counting timeouts and
+// SERVFAIL answers as failures among others.
+func summarizeLookups(duration time.Duration, samples []lookupSample) (*performance.Metrics, int, int) {
+	var failed, timeouts, servfails int
+	latencies := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		latencies[i] = s.latency
+		switch s.failure {
+		case "":
+			continue
+		case ReasonTimeout:
+			timeouts++
+		case "SERVFAIL":
+			servfails++
+		}
+		failed++
+	}
+	if duration <= 0 {
+		for _, l := range latencies {
+			duration += l
+		}
+	}
+	metrics := performance.NewMetrics(duration, len(samples), len(samples)-failed, failed, latencies)
+	return metrics, timeouts, servfails
+}
+
+// percent returns n as a percentage of total.
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
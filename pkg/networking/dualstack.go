@@ -0,0 +1,166 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+// ipFamily returns the family of an IP address or CIDR.
+func ipFamily(address string) corev1.IPFamily {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		ip, _, _ = net.ParseCIDR(address)
+	}
+	if ip != nil && ip.To4() == nil {
+		return corev1.IPv6Protocol
+	}
+	return corev1.IPv4Protocol
+}
+
+// familyAddresses groups addresses by IP family.
+func familyAddresses(addresses []string) map[corev1.IPFamily][]string {
+	byFamily := map[corev1.IPFamily][]string{}
+	for _, address := range addresses {
+		family := ipFamily(address)
+		byFamily[family] = append(byFamily[family], address)
+	}
+	return byFamily
+}
+
+// dualStackFamilies are the families a dual-stack cluster provides, in the
+// order they are reported.
+var dualStackFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+
+// TestDualStack checks IPv4/IPv6 dual-stack networking. It is skipped unless
+// node pod CIDRs or ServiceCIDRs have both families. It then checks that
+// pods get an address of each family, that a RequireDualStack service gets a
+// ClusterIP of each family, and that pod-to-pod and pod-to-service requests
+// work over both.
+func TestDualStack(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	// Detect dual-stack from the node pod CIDRs and the ServiceCIDRs.
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var podCIDRs, singleStackNodes []string
+	for _, node := range nodes.Items {
+		podCIDRs = append(podCIDRs, node.Spec.PodCIDRs...)
+		if len(node.Spec.PodCIDRs) > 0 && len(familyAddresses(node.Spec.PodCIDRs)) < 2 {
+			singleStackNodes = append(singleStackNodes, node.Name)
+		}
+	}
+	var serviceCIDRs []string
+	cidrs, err := clientset.NetworkingV1().ServiceCIDRs().List(ctx, metav1.ListOptions{})
+	switch {
+	case err == nil:
+		for _, cidr := range cidrs.Items {
+			serviceCIDRs = append(serviceCIDRs, cidr.Spec.CIDRs...)
+		}
+	case !apierrors.IsNotFound(err):
+		return fmt.Errorf("failed to list service CIDRs: %w", err)
+	}
+	podFamilies, serviceFamilies := familyAddresses(podCIDRs), familyAddresses(serviceCIDRs)
+	if len(podFamilies) < 2 && len(serviceFamilies) < 2 {
+		return check.Skip("cluster is not dual-stack: pod CIDRs %s, service CIDRs %s",
+			describeCIDRs(podCIDRs), describeCIDRs(serviceCIDRs))
+	}
+	if len(singleStackNodes) > 0 {
+		return fmt.Errorf("nodes %s have single-stack pod CIDRs", strings.Join(singleStackNodes, ", "))
+	}
+	if len(serviceCIDRs) > 0 && len(serviceFamilies) < 2 {
+		return fmt.Errorf("pod CIDRs are dual-stack but service CIDRs %s are not", describeCIDRs(serviceCIDRs))
+	}
+
+	requireDualStack := corev1.IPFamilyPolicyRequireDualStack
+	f, cleanup, err := startServiceFixture(ctx, env, namespace, func(spec *corev1.ServiceSpec) {
+		spec.IPFamilyPolicy = &requireDualStack
+		spec.IPFamilies = dualStackFamilies
+	})
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	// Every pod must have an address of each family.
+	podIPs := map[corev1.IPFamily][]string{}
+	for _, name := range append(slices.Clone(f.backends), f.client) {
+		pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get pod %s: %w", name, err)
+		}
+		var ips []string
+		for _, ip := range pod.Status.PodIPs {
+			ips = append(ips, ip.IP)
+		}
+		byFamily := familyAddresses(ips)
+		for _, family := range dualStackFamilies {
+			if len(byFamily[family]) == 0 {
+				return fmt.Errorf("pod %s has no %s address (pod IPs: %s)", name, family, strings.Join(ips, ", "))
+			}
+			if name != f.client {
+				podIPs[family] = append(podIPs[family], byFamily[family][0])
+			}
+		}
+	}
+
+	clusterIPs := familyAddresses(f.service.Spec.ClusterIPs)
+	for _, family := range dualStackFamilies {
+		if len(clusterIPs[family]) == 0 {
+			return fmt.Errorf("dual-stack service %s has no %s cluster IP (cluster IPs: %s)",
+				f.service.Name, family, strings.Join(f.service.Spec.ClusterIPs, ", "))
+		}
+	}
+
+	for _, family := range dualStackFamilies {
+		// Pod to pod: one request to each backend's address of the family.
+		urls := make([]string, len(podIPs[family]))
+		for i, ip := range podIPs[family] {
+			urls[i] = httpURL(ip, backendPort)
+		}
+		results, err := probeHTTPAll(ctx, env, namespace, f.client, urls)
+		if err != nil {
+			return err
+		}
+		var slowest time.Duration
+		for i, result := range results {
+			if result.Err != nil {
+				return fmt.Errorf("%s pod-to-pod request to %s failed: %w", family, f.backends[i], result.Err)
+			}
+			slowest = max(slowest, result.Latency)
+		}
+
+		// Pod to service through the family's ClusterIP.
+		url := httpURL(clusterIPs[family][0], 80)
+		hits, err := requestSpread(ctx, env, namespace, f.client, url, len(f.backends)*requestsPerBackend, f.backends)
+		if err != nil {
+			return fmt.Errorf("%s service %s: %w", family, url, err)
+		}
+		env.Notef("%s: pod-to-pod up to %s, ClusterIP %s %s", family, slowest.Round(time.Microsecond), clusterIPs[family][0], hits)
+	}
+
+	return nil
+}
+
+// describeCIDRs lists CIDRs for messages.
+func describeCIDRs(cidrs []string) string {
+	if len(cidrs) == 0 {
+		return "unknown"
+	}
+	return strings.Join(cidrs, ", ")
+}
@@ -0,0 +1,179 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/netperf"
+)
+
+// TestEgress probes the configured targets, URLs or host:port pairs, from a
+// pod running the netperf image and reports for each whether it was reached
+// and how long DNS, connecting and the TLS handshake took. URL targets go
+// through the configured proxy, or any the cluster injects into the pod's
+// environment. Without targets an in-cluster service stands in for an
+// external endpoint. Any unreachable target fails the check.
+func TestEgress(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	image := env.Settings.Image
+	if image == "" {
+		image = defaultNetperfImage
+	}
+
+	client := netperfPod(env, namespace, env.Name("egress-client"), image)
+	pods := []*corev1.Pod{client}
+	targets := env.Settings.Targets
+	proxy := env.Settings.Proxy
+	var standIn *corev1.Pod
+	var serviceName string
+	var selector map[string]string
+	if len(targets) == 0 {
+		serviceName = env.Name("egress-standin")
+		selector = env.Selector(serviceName)
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      serviceName,
+				Namespace: namespace,
+				Labels:    env.Labels(nil),
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: selector,
+				Ports:    []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(backendPort)}},
+			},
+		}
+		if _, err := clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create service: %w", err)
+		}
+		defer env.Cleanup("service", serviceName, func(ctx context.Context) error {
+			return clientset.CoreV1().Services(namespace).Delete(ctx, serviceName, metav1.DeleteOptions{})
+		})
+		standIn = newServerPod(env, namespace, env.Name("egress-standin"), selector)
+		pods = append(pods, standIn)
+		targets = []string{httpURL(serviceName+"."+namespace+".svc", 80)}
+		env.Notef("no targets configured, probed in-cluster stand-in %s", targets[0])
+		// A proxy outside the cluster cannot reach the stand-in.
+		if proxy != (check.Proxy{}) {
+			proxy.NoProxy = strings.Trim(proxy.NoProxy+","+serviceName+"."+namespace+".svc", ",")
+		}
+	}
+	client.Spec.Containers[0].Env = proxyEnv(proxy)
+	if proxy.HTTPS != "" || proxy.HTTP != "" {
+		env.Notef("URL targets sent through proxy %s", strings.Join(nonEmpty(proxy.HTTPS, proxy.HTTP), ", "))
+	}
+
+	deletePods, err := createPods(ctx, env, pods...)
+	defer deletePods()
+	if err != nil {
+		return err
+	}
+	if standIn != nil {
+		if _, err := waitForEndpoints(ctx, env, namespace, serviceName, selector, []string{standIn.Name}); err != nil {
+			return err
+		}
+	}
+	if _, err := waitForPodRunning(ctx, env, namespace, client.Name); err != nil {
+		return err
+	}
+
+	results, err := probeTargets(ctx, env, namespace, client.Name, targets)
+	if err != nil {
+		return err
+	}
+
+	env.Detailf("%-48s %-18s %9s %9s %9s %9s", "TARGET", "RESULT", "DNS", "CONNECT", "TLS", "TOTAL")
+	var reachable int
+	var unreachable []string
+	for _, result := range results {
+		outcome := "unreachable"
+		switch {
+		case result.Reachable && result.Status != 0:
+			outcome = fmt.Sprintf("reachable (%d)", result.Status)
+		case result.Reachable:
+			outcome = "reachable"
+		}
+		env.Detailf("%-48s %-18s %9s %9s %9s %9s", result.Target, outcome,
+			phase(result.DNS), phase(result.Connect), phase(result.TLS), phase(result.Total))
+		if result.Reachable {
+			reachable++
+			continue
+		}
+		env.Detailf("  %s", result.Error)
+		unreachable = append(unreachable, fmt.Sprintf("%s (%s)", result.Target, result.Error))
+	}
+	env.Notef("%d of %d targets reachable", reachable, len(results))
+
+	if len(unreachable) > 0 {
+		return fmt.Errorf("unreachable targets: %s", strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+// proxyEnv returns the environment variables configuring proxy.
+func proxyEnv(proxy check.Proxy) []corev1.EnvVar {
+	var vars []corev1.EnvVar
+	for _, v := range []corev1.EnvVar{
+		{Name: "HTTP_PROXY", Value: proxy.HTTP},
+		{Name: "HTTPS_PROXY", Value: proxy.HTTPS},
+		{Name: "NO_PROXY", Value: proxy.NoProxy},
+	} {
+		if v.Value != "" {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// nonEmpty returns the distinct values that are not empty.
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" && !slices.Contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// probeTargets runs netperf probe in the pod and returns a result per
+// target.
+func probeTargets(ctx context.Context, env *check.Env, namespace, pod string, targets []string) ([]netperf.ProbeResult, error) {
+	command := append([]string{"netperf", "probe", "--timeout", probeTimeout.String()}, targets...)
+	stdout, stderr, err := env.Exec(ctx, namespace, pod, command...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exec in pod %s: %w (%s)", pod, err, strings.TrimSpace(stderr))
+	}
+	var results []netperf.ProbeResult
+	decoder := json.NewDecoder(strings.NewReader(stdout))
+	for decoder.More() {
+		var result netperf.ProbeResult
+		if err := decoder.Decode(&result); err != nil {
+			return nil, fmt.Errorf("unexpected probe output in pod %s: %q", pod, stdout)
+		}
+		results = append(results, result)
+	}
+	if len(results) != len(targets) {
+		return nil, fmt.Errorf("pod %s reported %d of %d targets", pod, len(results), len(targets))
+	}
+	return results, nil
+}
+
+// phase formats the duration of a probe phase, or "-" if it did not happen.
+func phase(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(10 * time.Microsecond).String()
+}
@@ -0,0 +1,189 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+// TestNodePortService puts backend pods behind a NodePort service and
+// requests a page from the node port on every node from a client pod, and
+// from the ktest host when ProbeFromHost is set.
+func TestNodePortService(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	f, cleanup, err := startServiceFixture(ctx, env, namespace, func(spec *corev1.ServiceSpec) {
+		spec.Type = corev1.ServiceTypeNodePort
+	})
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	nodePort := int(f.service.Spec.Ports[0].NodePort)
+	if nodePort == 0 {
+		return fmt.Errorf("service %s was not assigned a node port", f.service.Name)
+	}
+
+	nodes, err := env.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var names, urls []string
+	for _, node := range nodes.Items {
+		if ip := nodeAddress(&node, corev1.NodeInternalIP); ip != "" {
+			names = append(names, node.Name)
+			urls = append(urls, httpURL(ip, nodePort))
+		}
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("no node has an internal IP")
+	}
+
+	results, err := probeHTTPAll(ctx, env, namespace, f.client, urls)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	var slowest time.Duration
+	for i, result := range results {
+		switch {
+		case result.Err != nil:
+			failures = append(failures, fmt.Sprintf("%s: %v", names[i], result.Err))
+		case !slices.Contains(f.backends, result.Body):
+			failures = append(failures, fmt.Sprintf("%s: unexpected response %q", names[i], result.Body))
+		case result.Latency > slowest:
+			slowest = result.Latency
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("node port %d failed from pods on %d of %d nodes: %s",
+			nodePort, len(failures), len(urls), strings.Join(failures, "; "))
+	}
+	env.Notef("node port %d reachable from pods on %d nodes, slowest %s", nodePort, len(urls), slowest.Round(time.Microsecond))
+
+	if !env.Settings.ProbeFromHost {
+		return nil
+	}
+	for _, node := range nodes.Items {
+		ip := nodeAddress(&node, corev1.NodeExternalIP)
+		if ip == "" {
+			ip = nodeAddress(&node, corev1.NodeInternalIP)
+		}
+		if ip == "" {
+			continue
+		}
+		if _, err := probeFromHost(ctx, httpURL(ip, nodePort)); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", node.Name, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("node port %d failed from this host on %d nodes: %s",
+			nodePort, len(failures), strings.Join(failures, "; "))
+	}
+	env.Notef("reachable from this host")
+
+	return nil
+}
+
+// TestLoadBalancerService puts backend pods behind a LoadBalancer service,
+// waits for an ingress address and requests pages from it from a client pod,
+// and from the ktest host when ProbeFromHost is set. It is skipped when no
+// load balancer controller acts on the service.
+func TestLoadBalancerService(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	f, cleanup, err := startServiceFixture(ctx, env, namespace, func(spec *corev1.ServiceSpec) {
+		spec.Type = corev1.ServiceTypeLoadBalancer
+	})
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	ingress, err := waitForLoadBalancer(ctx, env, namespace, f.service.Name)
+	if err != nil {
+		return err
+	}
+	env.Notef("address assigned in %s", time.Since(start).Round(time.Second))
+
+	address := ingress.IP
+	if address == "" {
+		address = ingress.Hostname
+	}
+	url := httpURL(address, 80)
+	hits, err := requestSpread(ctx, env, namespace, f.client, url, len(f.backends)*requestsPerBackend, f.backends)
+	if err != nil {
+		return fmt.Errorf("load balancer %s: %w", url, err)
+	}
+	env.Notef("%s: %s", url, hits)
+
+	if env.Settings.ProbeFromHost {
+		latency, err := probeFromHost(ctx, url)
+		if err != nil {
+			return fmt.Errorf("load balancer from this host: %w", err)
+		}
+		env.Notef("reachable from this host in %s", latency.Round(time.Millisecond))
+	}
+
+	return nil
+}
+
+// waitForLoadBalancer waits for the service to get an ingress address. When
+// none is assigned and no controller has recorded an event for the service,
+// the cluster has no load balancer controller and the check is skipped.
+func waitForLoadBalancer(ctx context.Context, env *check.Env, namespace, name string) (corev1.LoadBalancerIngress, error) {
+	var service *corev1.Service
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			var err error
+			service, err = env.Clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return len(service.Status.LoadBalancer.Ingress) > 0, nil
+		})
+	if err == nil {
+		return service.Status.LoadBalancer.Ingress[0], nil
+	}
+	if !wait.Interrupted(err) || ctx.Err() != nil {
+		return corev1.LoadBalancerIngress{}, fmt.Errorf("failed waiting for load balancer: %w", err)
+	}
+
+	selector := fields.Set{"involvedObject.kind": "Service", "involvedObject.name": name}.String()
+	events, listErr := env.Clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if listErr != nil {
+		return corev1.LoadBalancerIngress{}, fmt.Errorf("service %s got no load balancer address within %s: %w", name, env.Timeout(), err)
+	}
+	if len(events.Items) == 0 {
+		return corev1.LoadBalancerIngress{}, check.Skip("no load balancer controller assigned an address to service %s within %s", name, env.Timeout())
+	}
+	last := events.Items[len(events.Items)-1]
+	return corev1.LoadBalancerIngress{}, fmt.Errorf("service %s got no load balancer address within %s, last event: %s: %s",
+		name, env.Timeout(), last.Reason, last.Message)
+}
+
+// nodeAddress returns the node's first address of the given type.
+func nodeAddress(node *corev1.Node, addressType corev1.NodeAddressType) string {
+	for _, address := range node.Status.Addresses {
+		if address.Type == addressType {
+			return address.Address
+		}
+	}
+	return ""
+}
@@ -0,0 +1,227 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const (
+	// hostNetworkPort is where the hostNetwork test pod serves HTTP on its
+	// node. Unlike object names it cannot be unique per run, so a run finding
+	// it taken on every node skips the check.
+	hostNetworkPort = 19081
+	// hostPortPort is the hostPort the hostPort test pod is published on.
+	hostPortPort = 19082
+)
+
+// portConflict returns why pod cannot get its port on the node, or "" when
+// nothing shows a conflict. The scheduler reports no node with the port free
+// when pods, such as those of a concurrent run, hold it; other processes on
+// the node make the server fail to bind.
+func portConflict(pod *corev1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse &&
+			strings.Contains(condition.Message, "free ports") {
+			return condition.Message
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		for _, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+			if t := state.Terminated; t != nil && strings.Contains(t.Message, "in use") {
+				return strings.TrimSpace(t.Message)
+			}
+		}
+	}
+	return ""
+}
+
+// waitForHostPod waits like waitForPodRunning for a pod using port on its
+// node, and skips the check when the port is taken.
+func waitForHostPod(ctx context.Context, env *check.Env, namespace, name string, port int) (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	var conflict string
+	err := wait.PollUntilContextTimeout(ctx, 1*time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			var err error
+			pod, err = env.Clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			if conflict = portConflict(pod); conflict != "" {
+				return true, nil
+			}
+			if pod.Status.Phase == corev1.PodRunning {
+				return podReady(pod), nil
+			}
+			return false, podStartError(pod)
+		})
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("pod %s is not running: %w", name, err)
+	case conflict != "":
+		return nil, check.Skip("port %d is taken, possibly by a concurrent ktest run: %s", port, conflict)
+	}
+	return pod, nil
+}
+
+// startHostPodAndClient creates server, which must serve its hostname over
+// HTTP on port of its node, and a regular client pod, and waits until both
+// run. It returns the running server and the node it runs on. The returned
+// function deletes the pods and must be deferred even when an error is
+// returned.
+func startHostPodAndClient(ctx context.Context, env *check.Env, namespace string, server, client *corev1.Pod, port int) (*corev1.Pod, *corev1.Node, func(), error) {
+	// The bind error of a server whose port is taken shows in its status.
+	server.Spec.Containers[0].TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	cleanup, err := createPods(ctx, env, server, client)
+	if err != nil {
+		return nil, nil, cleanup, err
+	}
+	running, err := waitForHostPod(ctx, env, namespace, server.Name, port)
+	if err != nil {
+		return nil, nil, cleanup, err
+	}
+	if _, err := waitForPodRunning(ctx, env, namespace, client.Name); err != nil {
+		return nil, nil, cleanup, err
+	}
+	node, err := env.Clientset.CoreV1().Nodes().Get(ctx, running.Spec.NodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, cleanup, fmt.Errorf("failed to get node %s: %w", running.Spec.NodeName, err)
+	}
+	return running, node, cleanup, nil
+}
+
+// nodeHasIP reports whether ip is one of node's addresses.
+func nodeHasIP(node *corev1.Node, ip string) bool {
+	for _, address := range node.Status.Addresses {
+		if address.Address == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// TestHostNetworkPod runs an HTTP server in a hostNetwork pod, checks that
+// its pod IP is its node's IP, and requests a page from it on the node IP
+// from a regular pod.
+func TestHostNetworkPod(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	server := newServerPod(env, namespace, env.Name("host-network-server"), nil)
+	server.Spec.HostNetwork = true
+	server.Spec.Containers = []corev1.Container{httpdContainer(hostNetworkPort)}
+	client := newClientPod(env, namespace, env.Name("host-network-client"), nil)
+	running, node, cleanup, err := startHostPodAndClient(ctx, env, namespace, server, client, hostNetworkPort)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	ip := running.Status.PodIP
+	if !nodeHasIP(node, ip) {
+		return fmt.Errorf("hostNetwork pod %s has IP %s, which is not an address of node %s", server.Name, ip, node.Name)
+	}
+	latency, err := probeHTTP(ctx, env, namespace, client.Name, httpURL(ip, hostNetworkPort))
+	if err != nil {
+		return fmt.Errorf("regular pod could not reach hostNetwork pod on node %s: %w", node.Name, err)
+	}
+	env.Notef("hostNetwork pod on node %s serves on node IP %s port %d, reached from a regular pod in %s",
+		node.Name, ip, hostNetworkPort, latency.Round(time.Microsecond))
+	return nil
+}
+
+// TestHostPortPod runs an HTTP server in a regular pod whose port is
+// published as a hostPort and requests a page from the node IP and host
+// port from another pod.
+func TestHostPortPod(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	server := newServerPod(env, namespace, env.Name("host-port-server"), nil)
+	server.Spec.Containers[0].Ports[0].HostPort = hostPortPort
+	client := newClientPod(env, namespace, env.Name("host-port-client"), nil)
+	running, node, cleanup, err := startHostPodAndClient(ctx, env, namespace, server, client, hostPortPort)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	hostIP := running.Status.HostIP
+	if !nodeHasIP(node, hostIP) {
+		return fmt.Errorf("pod %s reports host IP %s, which is not an address of node %s", server.Name, hostIP, node.Name)
+	}
+	url := httpURL(hostIP, hostPortPort)
+	results, err := probeHTTPAll(ctx, env, namespace, client.Name, []string{url})
+	if err != nil {
+		return err
+	}
+	switch result := results[0]; {
+	case result.Err != nil:
+		return fmt.Errorf("regular pod could not reach host port %d on node %s: %w", hostPortPort, node.Name, result.Err)
+	case result.Body != server.Name:
+		return fmt.Errorf("host port %d on node %s answered %q, expected pod %s", hostPortPort, node.Name, result.Body, server.Name)
+	default:
+		env.Notef("host port %d on node %s IP %s forwards to pod %s, reached from a regular pod in %s",
+			hostPortPort, node.Name, hostIP, server.Name, result.Latency.Round(time.Microsecond))
+	}
+	return nil
+}
+
+// TestHostNetworkDNS starts a hostNetwork pod with dnsPolicy
+// ClusterFirstWithHostNet, checks that it is given the cluster resolver
+// rather than the node's, and resolves the kubernetes service from it.
+func TestHostNetworkDNS(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	pod := newClientPod(env, namespace, env.Name("host-network-dns"), nil)
+	pod.Spec.HostNetwork = true
+	pod.Spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	cleanup, err := createPods(ctx, env, pod)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	if _, err := waitForPodRunning(ctx, env, namespace, pod.Name); err != nil {
+		return err
+	}
+
+	conf, err := readResolvConf(ctx, env, namespace, pod.Name)
+	if err != nil {
+		return err
+	}
+	domain := conf.clusterDomain(namespace)
+	if !slices.Contains(conf.search, namespace+".svc."+domain) {
+		return fmt.Errorf("hostNetwork pod with dnsPolicy %s got the node's resolver: nameservers %s, search %s",
+			corev1.DNSClusterFirstWithHostNet, strings.Join(conf.nameservers, ", "), strings.Join(conf.search, " "))
+	}
+	client := &dnsClient{namespace: namespace, pod: pod.Name, conf: conf, domain: domain}
+
+	service, err := env.Clientset.CoreV1().Services(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the kubernetes service: %w", err)
+	}
+	name := client.serviceName("kubernetes", metav1.NamespaceDefault)
+	for _, ip := range clusterIPs(service) {
+		if _, err := client.expect(ctx, env, addressType(ip), name, ip); err != nil {
+			return err
+		}
+	}
+	env.Notef("hostNetwork pod uses nameserver %s and resolved %s", strings.Join(conf.nameservers, ", "), name)
+	return nil
+}
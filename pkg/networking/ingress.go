@@ -0,0 +1,475 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const (
+	// defaultIngressClassAnnotation marks the cluster's default IngressClass.
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+	// testDomain is the parent of the host names routes are created for.
+	testDomain = "ktest.example"
+	// gatewayGroupVersion is the Gateway API version routes are created in.
+	gatewayGroupVersion = "gateway.networking.k8s.io/v1"
+)
+
+var (
+	gatewayResource   = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+	httpRouteResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+)
+
+// routingFixture is two services an ingress or route sends traffic to by
+// path, and a client pod.
+type routingFixture struct {
+	root   *serviceFixture
+	routed *serviceFixture
+}
+
+// startRoutingFixture starts two services with backends. The returned
+// function deletes everything and must be deferred even on error.
+func startRoutingFixture(ctx context.Context, env *check.Env, namespace string) (*routingFixture, func(), error) {
+	root, cleanupRoot, err := startServiceFixture(ctx, env, namespace, nil)
+	if err != nil {
+		return nil, cleanupRoot, err
+	}
+	routed, cleanupRouted, err := startServiceFixture(ctx, env, namespace, nil)
+	cleanup := func() {
+		cleanupRouted()
+		cleanupRoot()
+	}
+	if err != nil {
+		return nil, cleanup, err
+	}
+	return &routingFixture{root: root, routed: routed}, cleanup, nil
+}
+
+// routeCase is a request whose routing is checked.
+type routeCase struct {
+	name string
+	host string
+	path string
+	// backends are the pods allowed to answer. When empty, no test backend
+	// may answer.
+	backends []string
+}
+
+// routeCases are requests for / and routedPath on host, which must reach
+// the root and routed services, and for / on another host, which must not
+// reach either.
+func (f *routingFixture) routeCases(host string) []routeCase {
+	other := "unrouted." + testDomain
+	return []routeCase{
+		{name: host + "/", host: host, path: "/", backends: f.root.backends},
+		{name: host + routedPath, host: host, path: routedPath, backends: f.routed.backends},
+		{name: other + "/", host: other, path: "/"},
+	}
+}
+
+// verifyRouting sends every case's request to address:port from the client
+// pod until each is routed as expected, since controllers program routes
+// some time after accepting them. Every case's last outcome is added to the
+// details.
+func verifyRouting(ctx context.Context, env *check.Env, namespace, client, address string, port int, cases []routeCase) error {
+	var all []string
+	for _, c := range cases {
+		all = append(all, c.backends...)
+	}
+	base := strings.TrimSuffix(httpURL(address, port), "/")
+
+	outcomes := make([]string, len(cases))
+	var wrong int
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			wrong = 0
+			for i, c := range cases {
+				results, err := probeVirtualHost(ctx, env, namespace, client, c.host, []string{base + c.path})
+				if err != nil {
+					return false, err
+				}
+				result := results[0]
+				switch {
+				case result.Err != nil:
+					outcomes[i] = result.Err.Error()
+				case slices.Contains(all, result.Body):
+					outcomes[i] = "answered by " + result.Body
+				default:
+					outcomes[i] = fmt.Sprintf("answered %q", result.Body)
+				}
+				reached := result.Err == nil && slices.Contains(c.backends, result.Body)
+				unrouted := result.Err != nil || !slices.Contains(all, result.Body)
+				if (len(c.backends) > 0 && !reached) || (len(c.backends) == 0 && !unrouted) {
+					wrong++
+				}
+			}
+			return wrong == 0, nil
+		})
+
+	for i, c := range cases {
+		expected := "not routed to a test backend"
+		if len(c.backends) > 0 {
+			expected = fmt.Sprintf("one of %d backends", len(c.backends))
+		}
+		env.Detailf("%-48s expected %s, %s", c.name, expected, outcomes[i])
+	}
+	if err != nil {
+		if wait.Interrupted(err) && ctx.Err() == nil {
+			return fmt.Errorf("%d of %d requests to %s not routed as expected after %s", wrong, len(cases), base, env.Timeout())
+		}
+		return err
+	}
+	return nil
+}
+
+// TestIngress routes a host's / and routedPath to two services with an
+// Ingress of the default IngressClass, waits for the controller to assign an
+// address and checks the routing with requests from a client pod. It is
+// skipped when no IngressClass is installed.
+func TestIngress(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	class, err := ingressClass(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	f, cleanup, err := startRoutingFixture(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	name := env.Name("ktest-ingress")
+	host := name + "." + testDomain
+	prefix := networkingv1.PathTypePrefix
+	backend := func(service string) networkingv1.IngressBackend {
+		return networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{
+				Name: service,
+				Port: networkingv1.ServiceBackendPort{Number: 80},
+			},
+		}
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    env.Labels(nil),
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &class,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{Path: "/", PathType: &prefix, Backend: backend(f.root.service.Name)},
+								{Path: strings.TrimSuffix(routedPath, "/"), PathType: &prefix, Backend: backend(f.routed.service.Name)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	if _, err := clientset.NetworkingV1().Ingresses(namespace).Create(ctx, ingress, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create ingress: %w", err)
+	}
+	defer env.Cleanup("ingress", name, func(ctx context.Context) error {
+		return clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	})
+
+	start := time.Now()
+	var address string
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			current, err := clientset.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			for _, lb := range current.Status.LoadBalancer.Ingress {
+				address = lb.IP
+				if address == "" {
+					address = lb.Hostname
+				}
+				if address != "" {
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+	if err != nil {
+		if wait.Interrupted(err) && ctx.Err() == nil {
+			return fmt.Errorf("ingress class %s assigned no address to ingress %s within %s", class, name, env.Timeout())
+		}
+		return fmt.Errorf("failed waiting for ingress address: %w", err)
+	}
+	env.Notef("ingress class %s assigned %s in %s", class, address, time.Since(start).Round(time.Second))
+
+	if err := verifyRouting(ctx, env, namespace, f.root.client, address, 80, f.routeCases(host)); err != nil {
+		return err
+	}
+	env.Notef("host and path routing verified")
+
+	return nil
+}
+
+// ingressClass returns the default IngressClass, or the first by name when
+// none is marked default.
+func ingressClass(ctx context.Context, env *check.Env) (string, error) {
+	classes, err := env.Clientset.NetworkingV1().IngressClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list ingress classes: %w", err)
+	}
+	if len(classes.Items) == 0 {
+		return "", check.Skip("no IngressClass is installed")
+	}
+	var names []string
+	for _, class := range classes.Items {
+		if class.Annotations[defaultIngressClassAnnotation] == "true" {
+			return class.Name, nil
+		}
+		names = append(names, class.Name)
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+// gatewayListener is an HTTP listener of a programmed Gateway.
+type gatewayListener struct {
+	namespace string
+	gateway   string
+	name      string
+	hostname  string
+	port      int
+	address   string
+}
+
+// TestGatewayHTTPRoute routes a host's / and routedPath to two services with
+// an HTTPRoute attached to an existing Gateway, waits for the Gateway to
+// accept it and checks the routing with requests from a client pod. It is
+// skipped without the Gateway API CRDs or a programmed Gateway with an HTTP
+// listener that admits routes from the test namespace.
+func TestGatewayHTTPRoute(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	if env.Dynamic == nil {
+		return check.Skip("Gateway API checks need a dynamic client")
+	}
+
+	resources, err := env.Clientset.Discovery().ServerResourcesForGroupVersion(gatewayGroupVersion)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to discover Gateway API resources: %w", err)
+	}
+	if resources == nil || !slices.ContainsFunc(resources.APIResources, func(r metav1.APIResource) bool {
+		return r.Name == httpRouteResource.Resource
+	}) {
+		return check.Skip("Gateway API CRDs (%s httproutes) are not installed", gatewayGroupVersion)
+	}
+
+	listener, err := findGatewayListener(ctx, env, namespace)
+	if err != nil {
+		return err
+	}
+
+	f, cleanup, err := startRoutingFixture(ctx, env, namespace)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	name := env.Name("ktest-route")
+	host := name + "." + testDomain
+	switch {
+	case strings.HasPrefix(listener.hostname, "*."):
+		host = name + strings.TrimPrefix(listener.hostname, "*")
+	case listener.hostname != "":
+		host = listener.hostname
+	}
+
+	routes := env.Dynamic.Resource(httpRouteResource).Namespace(namespace)
+	route := httpRoute(env, namespace, name, host, listener, f)
+	if _, err := routes.Create(ctx, route, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create HTTPRoute: %w", err)
+	}
+	defer env.Cleanup("httproute", name, func(ctx context.Context) error {
+		return routes.Delete(ctx, name, metav1.DeleteOptions{})
+	})
+
+	start := time.Now()
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			current, err := routes.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return routeAccepted(current, listener)
+		})
+	if err != nil {
+		if wait.Interrupted(err) && ctx.Err() == nil {
+			return fmt.Errorf("gateway %s/%s did not accept HTTPRoute %s within %s", listener.namespace, listener.gateway, name, env.Timeout())
+		}
+		return err
+	}
+	env.Notef("gateway %s/%s listener %s accepted the route in %s",
+		listener.namespace, listener.gateway, listener.name, time.Since(start).Round(time.Second))
+
+	if err := verifyRouting(ctx, env, namespace, f.root.client, listener.address, listener.port, f.routeCases(host)); err != nil {
+		return err
+	}
+	env.Notef("host and path routing verified")
+
+	return nil
+}
+
+// findGatewayListener returns an HTTP listener of a programmed Gateway with
+// an address that admits routes from namespace.
+func findGatewayListener(ctx context.Context, env *check.Env, namespace string) (gatewayListener, error) {
+	gateways, err := env.Dynamic.Resource(gatewayResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return gatewayListener{}, fmt.Errorf("failed to list gateways: %w", err)
+	}
+	for _, gw := range gateways.Items {
+		if !hasCondition(gw.Object, "Programmed", "status", "conditions") {
+			continue
+		}
+		addresses, _, _ := unstructured.NestedSlice(gw.Object, "status", "addresses")
+		if len(addresses) == 0 {
+			continue
+		}
+		first, ok := addresses[0].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		address, _, _ := unstructured.NestedString(first, "value")
+		listeners, _, _ := unstructured.NestedSlice(gw.Object, "spec", "listeners")
+		for _, l := range listeners {
+			listener, ok := l.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			protocol, _, _ := unstructured.NestedString(listener, "protocol")
+			from, _, _ := unstructured.NestedString(listener, "allowedRoutes", "namespaces", "from")
+			if from == "" {
+				from = "Same"
+			}
+			if protocol != "HTTP" || !(from == "All" || (from == "Same" && gw.GetNamespace() == namespace)) {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(listener, "name")
+			hostname, _, _ := unstructured.NestedString(listener, "hostname")
+			port, _, _ := unstructured.NestedInt64(listener, "port")
+			return gatewayListener{
+				namespace: gw.GetNamespace(),
+				gateway:   gw.GetName(),
+				name:      name,
+				hostname:  hostname,
+				port:      int(port),
+				address:   address,
+			}, nil
+		}
+	}
+	return gatewayListener{}, check.Skip("no programmed Gateway has an HTTP listener admitting routes from namespace %s", namespace)
+}
+
+// httpRoute returns an HTTPRoute attached to listener that sends host's /
+// and routedPath to the fixture's services.
+func httpRoute(env *check.Env, namespace, name, host string, listener gatewayListener, f *routingFixture) *unstructured.Unstructured {
+	rule := func(path, service string) interface{} {
+		return map[string]interface{}{
+			"matches": []interface{}{
+				map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": path}},
+			},
+			"backendRefs": []interface{}{
+				map[string]interface{}{"name": service, "port": int64(80)},
+			},
+		}
+	}
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gatewayGroupVersion,
+		"kind":       "HTTPRoute",
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{
+				map[string]interface{}{
+					"name":        listener.gateway,
+					"namespace":   listener.namespace,
+					"sectionName": listener.name,
+				},
+			},
+			"hostnames": []interface{}{host},
+			"rules": []interface{}{
+				rule("/", f.root.service.Name),
+				rule(strings.TrimSuffix(routedPath, "/"), f.routed.service.Name),
+			},
+		},
+	}}
+	route.SetName(name)
+	route.SetNamespace(namespace)
+	route.SetLabels(env.Labels(nil))
+	return route
+}
+
+// routeAccepted reports whether the listener's Gateway accepted the route.
+// A rejection is returned as an error with the Gateway's reason.
+func routeAccepted(route *unstructured.Unstructured, listener gatewayListener) (bool, error) {
+	parents, _, _ := unstructured.NestedSlice(route.Object, "status", "parents")
+	for _, p := range parents {
+		parent, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(parent, "parentRef", "name")
+		if name != listener.gateway {
+			continue
+		}
+		conditions, _, _ := unstructured.NestedSlice(parent, "conditions")
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["type"] != "Accepted" {
+				continue
+			}
+			if condition["status"] == string(metav1.ConditionTrue) {
+				return true, nil
+			}
+			if condition["status"] == string(metav1.ConditionFalse) {
+				return false, fmt.Errorf("gateway %s/%s rejected HTTPRoute %s: %v: %v",
+					listener.namespace, listener.gateway, route.GetName(), condition["reason"], condition["message"])
+			}
+		}
+	}
+	return false, nil
+}
+
+// hasCondition reports whether the condition list at fields has conditionType
+// set to True.
+func hasCondition(object map[string]interface{}, conditionType string, fields ...string) bool {
+	conditions, _, _ := unstructured.NestedSlice(object, fields...)
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == conditionType && condition["status"] == string(corev1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
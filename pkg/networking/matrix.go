@@ -0,0 +1,475 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const (
+	// probePort is where probe pods serve HTTP on the pod network.
+	probePort = 8080
+	// hostProbePort is where host network probe pods serve HTTP on every
+	// node. It must be free on all nodes.
+	hostProbePort = 19080
+	// matrixParallelism bounds how many probe pods send requests at once.
+	matrixParallelism = 10
+)
+
+// probeDaemonSet returns a DaemonSet that runs a busybox HTTP server on every
+// node, including tainted ones, on the pod network or the host network.
+func probeDaemonSet(env *check.Env, namespace, name, app string, hostNetwork bool, port int) *appsv1.DaemonSet {
+	selector := env.Selector(app)
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    env.Labels(nil),
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: selector,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: env.Labels(selector),
+				},
+				Spec: corev1.PodSpec{
+					HostNetwork: hostNetwork,
+					Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					Containers:  []corev1.Container{httpdContainer(port)},
+				},
+			},
+		},
+	}
+}
+
+// daemonSetPods are the pods of a probe DaemonSet: the ready ones sorted by
+// node name, and why the pod on each other node is not ready.
+type daemonSetPods struct {
+	ready    []corev1.Pod
+	notReady map[string]string
+}
+
+// waitForDaemonSetPods waits until the pod of the DaemonSet on every node it
+// is scheduled to is ready or cannot start. When the timeout passes first,
+// the pods ready by then are returned so that the other nodes can be shown
+// as not ready; it only fails when no pod became ready.
+func waitForDaemonSetPods(ctx context.Context, env *check.Env, namespace string, ds *appsv1.DaemonSet) (*daemonSetPods, error) {
+	selector := labels.SelectorFromSet(ds.Spec.Selector.MatchLabels).String()
+	var ready []corev1.Pod
+	var notReady map[string]string
+	var desired int32
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			current, err := env.Clientset.AppsV1().DaemonSets(namespace).Get(ctx, ds.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			desired = current.Status.DesiredNumberScheduled
+
+			pods, err := env.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				return false, err
+			}
+			ready, notReady = ready[:0], map[string]string{}
+			stuck := 0
+			for _, pod := range pods.Items {
+				node := daemonPodNode(&pod)
+				startErr := podStartError(&pod)
+				switch {
+				case pod.Status.Phase == corev1.PodRunning && podReady(&pod):
+					ready = append(ready, pod)
+				case startErr != nil:
+					// Waiting will not fix these.
+					notReady[node] = startErr.Error()
+					stuck++
+				case pod.Status.Phase == corev1.PodRunning:
+					notReady[node] = fmt.Sprintf("pod %s is running but not ready", pod.Name)
+				default:
+					notReady[node] = fmt.Sprintf("pod %s is %s", pod.Name, pod.Status.Phase)
+				}
+			}
+			return desired > 0 && int32(len(ready)+stuck) >= desired, nil
+		})
+	if err != nil && (!wait.Interrupted(err) || ctx.Err() != nil || len(ready) == 0) {
+		return nil, fmt.Errorf("daemonset %s has %d of %d pods ready: %w", ds.Name, len(ready), desired, err)
+	}
+	if len(ready) == 0 {
+		return nil, fmt.Errorf("daemonset %s has no ready pods: %s", ds.Name, describeNotReady(notReady))
+	}
+
+	sort.Slice(ready, func(i, j int) bool { return ready[i].Spec.NodeName < ready[j].Spec.NodeName })
+	return &daemonSetPods{ready: ready, notReady: notReady}, nil
+}
+
+// daemonPodNode returns the node a DaemonSet pod runs on, or is bound to by
+// the node affinity the DaemonSet controller sets while it is unscheduled.
+func daemonPodNode(pod *corev1.Pod) string {
+	if pod.Spec.NodeName != "" {
+		return pod.Spec.NodeName
+	}
+	if a := pod.Spec.Affinity; a != nil && a.NodeAffinity != nil && a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		for _, term := range a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			for _, field := range term.MatchFields {
+				if field.Key == "metadata.name" && len(field.Values) == 1 {
+					return field.Values[0]
+				}
+			}
+		}
+	}
+	return pod.Name
+}
+
+// describeNotReady lists why the probe on each node is not ready.
+func describeNotReady(notReady map[string]string) string {
+	nodes := make([]string, 0, len(notReady))
+	for node := range notReady {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = fmt.Sprintf("%s (%s)", node, notReady[node])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// matrixCell is the outcome of one probe in the connectivity matrix.
+type matrixCell struct {
+	probed  bool
+	latency time.Duration
+	err     error
+	// notReady is set when the source or target probe never became ready.
+	notReady bool
+}
+
+func (c matrixCell) String() string {
+	switch {
+	case c.notReady:
+		return "NR"
+	case !c.probed:
+		return "-"
+	case c.err != nil:
+		return "X"
+	default:
+		return fmt.Sprintf("%.1f", float64(c.latency)/float64(time.Millisecond))
+	}
+}
+
+// connectivityMatrix holds the results of every probe pod requesting a page
+// from every node, indexed by source and target node.
+type connectivityMatrix struct {
+	nodes []string
+	pod   [][]matrixCell
+	host  [][]matrixCell
+	// execErrors records probe pods that could not run their requests.
+	execErrors map[string]error
+	// podNotReady and hostNotReady record why the pod or host network probe
+	// on a node never became ready.
+	podNotReady  map[string]string
+	hostNotReady map[string]string
+}
+
+// TestNodeMatrix runs a probe pod on every node and has each of them request
+// a page from the probe pod on every other node, over the pod network and
+// from each node's host network. The N×N matrix of request times is added to
+// the result details, so that a single broken node or zone stands out.
+func TestNodeMatrix(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	podDS := probeDaemonSet(env, namespace, env.Name("netprobe"), "netprobe", false, probePort)
+	hostDS := probeDaemonSet(env, namespace, env.Name("netprobe-host"), "netprobe-host", true, hostProbePort)
+	for _, ds := range []*appsv1.DaemonSet{podDS, hostDS} {
+		if _, err := clientset.AppsV1().DaemonSets(namespace).Create(ctx, ds, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create probe daemonset: %w", err)
+		}
+		name := ds.Name
+		defer env.Cleanup("daemonset", name, func(ctx context.Context) error {
+			return clientset.AppsV1().DaemonSets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		})
+	}
+
+	podProbes, err := waitForDaemonSetPods(ctx, env, namespace, podDS)
+	if err != nil {
+		return err
+	}
+	hostProbes, err := waitForDaemonSetPods(ctx, env, namespace, hostDS)
+	if err != nil {
+		return err
+	}
+
+	matrix := probeMatrix(ctx, env, namespace, podProbes, hostProbes)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	matrix.render(env)
+	return matrix.result(env)
+}
+
+// probeMatrix has every ready pod probe request a page from every ready pod
+// and host probe. Paths from or to a probe that is not ready are marked as
+// such.
+func probeMatrix(ctx context.Context, env *check.Env, namespace string, podProbes, hostProbes *daemonSetPods) *connectivityMatrix {
+	podURLs := map[string]string{}
+	hostURLs := map[string]string{}
+	nodeSet := map[string]bool{}
+	for _, pod := range podProbes.ready {
+		podURLs[pod.Spec.NodeName] = httpURL(pod.Status.PodIP, probePort)
+		nodeSet[pod.Spec.NodeName] = true
+	}
+	for _, pod := range hostProbes.ready {
+		hostURLs[pod.Spec.NodeName] = httpURL(pod.Status.PodIP, hostProbePort)
+		nodeSet[pod.Spec.NodeName] = true
+	}
+	for _, notReady := range []map[string]string{podProbes.notReady, hostProbes.notReady} {
+		for node := range notReady {
+			nodeSet[node] = true
+		}
+	}
+
+	m := &connectivityMatrix{
+		execErrors:   map[string]error{},
+		podNotReady:  podProbes.notReady,
+		hostNotReady: hostProbes.notReady,
+	}
+	for node := range nodeSet {
+		m.nodes = append(m.nodes, node)
+	}
+	sort.Strings(m.nodes)
+	m.pod = make([][]matrixCell, len(m.nodes))
+	m.host = make([][]matrixCell, len(m.nodes))
+	row := map[string]int{}
+	for i, node := range m.nodes {
+		row[node] = i
+		m.pod[i] = make([]matrixCell, len(m.nodes))
+		m.host[i] = make([]matrixCell, len(m.nodes))
+		// Sources are always pod network probes.
+		_, sourceNotReady := m.podNotReady[node]
+		for j, target := range m.nodes {
+			_, podTarget := m.podNotReady[target]
+			_, hostTarget := m.hostNotReady[target]
+			m.pod[i][j].notReady = sourceNotReady || podTarget
+			m.host[i][j].notReady = sourceNotReady || hostTarget
+		}
+	}
+
+	// Every source requests the same URLs; targets records which cell each
+	// of them fills in.
+	type target struct {
+		host bool
+		col  int
+	}
+	var urls []string
+	var targets []target
+	for _, host := range []bool{false, true} {
+		byNode := podURLs
+		if host {
+			byNode = hostURLs
+		}
+		for j, node := range m.nodes {
+			if url, ok := byNode[node]; ok {
+				urls = append(urls, url)
+				targets = append(targets, target{host: host, col: j})
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, matrixParallelism)
+	for _, source := range podProbes.ready {
+		wg.Add(1)
+		go func(source corev1.Pod) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results, err := probeHTTPAll(ctx, env, namespace, source.Name, urls)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				m.execErrors[source.Spec.NodeName] = err
+				return
+			}
+			i := row[source.Spec.NodeName]
+			for k, result := range results {
+				cells := m.pod[i]
+				if targets[k].host {
+					cells = m.host[i]
+				}
+				cells[targets[k].col] = matrixCell{probed: true, latency: result.Latency, err: result.Err}
+			}
+		}(source)
+	}
+	wg.Wait()
+	return m
+}
+
+// render writes the matrices and every failure to the check's details.
+func (m *connectivityMatrix) render(env *check.Env) {
+	env.Detailf("Nodes:")
+	for i, node := range m.nodes {
+		env.Detailf("  [%d] %s", i+1, node)
+	}
+	m.renderTable(env, "Pod network", m.pod)
+	m.renderTable(env, "Host network", m.host)
+
+	var failures []string
+	for i, source := range m.nodes {
+		if reason, ok := m.podNotReady[source]; ok {
+			failures = append(failures, fmt.Sprintf("%s pod probe not ready: %s", source, reason))
+		}
+		if reason, ok := m.hostNotReady[source]; ok {
+			failures = append(failures, fmt.Sprintf("%s host probe not ready: %s", source, reason))
+		}
+		if err, ok := m.execErrors[source]; ok {
+			failures = append(failures, fmt.Sprintf("%s: %v", source, err))
+		}
+		for j, target := range m.nodes {
+			if err := m.pod[i][j].err; err != nil {
+				failures = append(failures, fmt.Sprintf("%s -> %s pod: %v", source, target, err))
+			}
+			if err := m.host[i][j].err; err != nil {
+				failures = append(failures, fmt.Sprintf("%s -> %s host: %v", source, target, err))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		env.Detailf("Failures:")
+		for _, failure := range failures {
+			env.Detailf("  %s", failure)
+		}
+	}
+}
+
+func (m *connectivityMatrix) renderTable(env *check.Env, title string, cells [][]matrixCell) {
+	env.Detailf("%s (request time in ms, X = failed, NR = probe not ready, - = not probed), rows are sources:", title)
+	header := fmt.Sprintf("  %-6s", "")
+	for j := range m.nodes {
+		header += fmt.Sprintf(" %7s", fmt.Sprintf("[%d]", j+1))
+	}
+	env.Detailf("%s", header)
+	for i := range m.nodes {
+		line := fmt.Sprintf("  %-6s", fmt.Sprintf("[%d]", i+1))
+		for j := range m.nodes {
+			line += fmt.Sprintf(" %7s", cells[i][j])
+		}
+		env.Detailf("%s", line)
+	}
+}
+
+// result summarises the matrix, naming nodes whose every inbound or outbound
+// probe failed since those are the likely culprits.
+func (m *connectivityMatrix) result(env *check.Env) error {
+	var probed, failed int
+	var slowest time.Duration
+	for _, cells := range [][][]matrixCell{m.pod, m.host} {
+		for _, row := range cells {
+			for _, cell := range row {
+				if !cell.probed {
+					continue
+				}
+				probed++
+				if cell.err != nil {
+					failed++
+				} else if cell.latency > slowest {
+					slowest = cell.latency
+				}
+			}
+		}
+	}
+
+	notReady := m.notReadyNodes()
+	if failed == 0 && len(m.execErrors) == 0 && len(notReady) == 0 {
+		env.Notef("%d nodes, %d paths, slowest request %s", len(m.nodes), probed, slowest.Round(time.Microsecond))
+		return nil
+	}
+
+	msg := fmt.Sprintf("%d of %d paths between %d nodes failed", failed, probed, len(m.nodes))
+	if len(m.execErrors) > 0 {
+		msg += fmt.Sprintf(", %d probe pods could not run", len(m.execErrors))
+	}
+	if len(notReady) > 0 {
+		msg += fmt.Sprintf(", probes not ready on %d nodes", len(notReady))
+	}
+	if suspects := m.suspects(); len(suspects) > 0 {
+		msg += "; suspect nodes: " + strings.Join(suspects, ", ")
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// suspects returns nodes whose probes all failed in one direction on the pod
+// or host network while other paths worked.
+func (m *connectivityMatrix) suspects() []string {
+	var suspects []string
+	notReady := m.notReadyNodes()
+	for i, node := range m.nodes {
+		if _, ok := m.execErrors[node]; ok || notReady[node] {
+			suspects = append(suspects, node)
+			continue
+		}
+		for _, cells := range [][][]matrixCell{m.pod, m.host} {
+			if allFailed(cells, i, true) || allFailed(cells, i, false) {
+				suspects = append(suspects, node)
+				break
+			}
+		}
+	}
+	if len(suspects) == len(m.nodes) {
+		// Everything is broken; no node stands out.
+		return nil
+	}
+	return suspects
+}
+
+// notReadyNodes returns the nodes whose pod or host network probe is not
+// ready.
+func (m *connectivityMatrix) notReadyNodes() map[string]bool {
+	nodes := map[string]bool{}
+	for _, notReady := range []map[string]string{m.podNotReady, m.hostNotReady} {
+		for node := range notReady {
+			nodes[node] = true
+		}
+	}
+	return nodes
+}
+
+// allFailed reports whether every probed path from (outbound) or to node i
+// failed, ignoring the node's paths to itself.
+func allFailed(cells [][]matrixCell, i int, outbound bool) bool {
+	probed := 0
+	for j := range cells {
+		if i == j {
+			continue
+		}
+		cell := cells[j][i]
+		if outbound {
+			cell = cells[i][j]
+		}
+		if !cell.probed {
+			continue
+		}
+		probed++
+		if cell.err == nil {
+			return false
+		}
+	}
+	return probed > 0
+}
@@ -0,0 +1,342 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/netperf"
+)
+
+// payloadSizes are the HTTP response sizes transferred, smallest first.
+var payloadSizes = []int{1 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20}
+
+// pingSizes are the ICMP payload sizes sent, smallest first, up to the
+// largest that fits the client's interface MTU, which is always added.
+var pingSizes = []int{56, 512, 1024, 1372, 1422, 1472, 8972}
+
+// pingTimeout is how long each ping waits for its reply.
+const pingTimeout = 2 * time.Second
+
+// icmpOverhead is the IP and ICMP header size added to a ping payload.
+var icmpOverhead = map[corev1.IPFamily]int{
+	corev1.IPv4Protocol: 28,
+	corev1.IPv6Protocol: 48,
+}
+
+// sizeResult is the outcome of one transfer or ping of a given size.
+type sizeResult struct {
+	size    int
+	latency time.Duration
+	// failure is empty when the transfer succeeded.
+	failure string
+}
+
+// payloadContainer returns a busybox container serving files of every
+// payloadSizes size at /payload-<size> on port.
+func payloadContainer(port int) corev1.Container {
+	sizes := make([]string, len(payloadSizes))
+	for i, size := range payloadSizes {
+		sizes[i] = strconv.Itoa(size)
+	}
+	script := fmt.Sprintf("mkdir -p /www && hostname > /www/index.html && "+
+		"for s in %s; do head -c $s /dev/zero > /www/payload-$s; done && exec httpd -f -p %d -h /www",
+		strings.Join(sizes, " "), port)
+	container := httpdContainer(port)
+	container.Command = []string{"sh", "-c", script}
+	return container
+}
+
+// TestPathMTU looks for MTU problems between nodes, which let small requests
+// through but make large ones hang. It starts a payload server and a client
+// running the netperf image on different nodes where possible and, from the
+// client:
+//
+//   - pings the server with growing payloads up to the client's interface
+//     MTU with the don't-fragment bit set, so a lost large ping means a
+//     smaller MTU on the path,
+//   - downloads growing payloads from the server pod IP and through a
+//     ClusterIP service.
+//
+// It reports the largest working sizes and fails when small sizes work but
+// larger ones do not, the sign of a fragmentation blackhole.
+func TestPathMTU(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	selector := env.Selector("mtu-server")
+	server := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      env.Name("mtu-server"),
+			Namespace: namespace,
+			Labels:    env.Labels(selector),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{payloadContainer(backendPort)},
+		},
+	}
+	image := env.Settings.Image
+	if image == "" {
+		image = defaultNetperfImage
+	}
+	client := netperfPod(env, namespace, env.Name("mtu-client"), image)
+	client.Spec.Affinity = &corev1.Affinity{
+		PodAntiAffinity: &corev1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+				{
+					Weight: 100,
+					PodAffinityTerm: corev1.PodAffinityTerm{
+						LabelSelector: &metav1.LabelSelector{MatchLabels: selector},
+						TopologyKey:   corev1.LabelHostname,
+					},
+				},
+			},
+		},
+	}
+
+	serviceName := env.Name("mtu-service")
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceName,
+			Namespace: namespace,
+			Labels:    env.Labels(nil),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: selector,
+			Ports:    []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(backendPort)}},
+		},
+	}
+	service, err := clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer env.Cleanup("service", serviceName, func(ctx context.Context) error {
+		return clientset.CoreV1().Services(namespace).Delete(ctx, serviceName, metav1.DeleteOptions{})
+	})
+
+	// The client is scheduled after the server so anti-affinity can apply.
+	deletePods, err := createPods(ctx, env, server, client)
+	defer deletePods()
+	if err != nil {
+		return err
+	}
+	runningServer, err := waitForPodRunning(ctx, env, namespace, server.Name)
+	if err != nil {
+		return err
+	}
+	runningClient, err := waitForPodRunning(ctx, env, namespace, client.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := waitForEndpoints(ctx, env, namespace, serviceName, selector, []string{server.Name}); err != nil {
+		return err
+	}
+	if runningServer.Spec.NodeName == runningClient.Spec.NodeName {
+		env.Notef("client and server share node %s, so no overlay path was tested", runningClient.Spec.NodeName)
+	}
+
+	stdout, _, err := env.Exec(ctx, namespace, client.Name, "cat", "/sys/class/net/eth0/mtu")
+	if err != nil {
+		return fmt.Errorf("failed to read the interface MTU in pod %s: %w", client.Name, err)
+	}
+	mtu, err := strconv.Atoi(strings.TrimSpace(stdout))
+	if err != nil {
+		return fmt.Errorf("unexpected interface MTU %q in pod %s", strings.TrimSpace(stdout), client.Name)
+	}
+
+	serverIP := runningServer.Status.PodIP
+	var problems []string
+
+	pings, err := pingSizesFrom(ctx, env, namespace, client.Name, serverIP, mtu)
+	if err != nil {
+		return err
+	}
+	env.Detailf("DF ping %s (interface MTU %d):", serverIP, mtu)
+	writeSizeResults(env, pings)
+	if largest, failed := largestWorking(pings); pings[0].failure != "" {
+		env.Notef("ping not possible (%s), ICMP path MTU not tested", pings[0].failure)
+	} else if failed > 0 {
+		problems = append(problems, fmt.Sprintf("pings with up to %d bytes work but %d bytes are lost, so the path MTU is below the interface MTU %d",
+			largest, failed, mtu))
+	} else {
+		env.Notef("interface MTU %d, DF pings up to %d bytes", mtu, largest)
+	}
+
+	targets := []struct {
+		name string
+		url  string
+	}{
+		{"pod IP", httpURL(serverIP, backendPort)},
+		{"ClusterIP", httpURL(service.Spec.ClusterIP, 80)},
+	}
+	for _, target := range targets {
+		transfers, err := transferSizes(ctx, env, namespace, client.Name, target.url)
+		if err != nil {
+			return err
+		}
+		env.Detailf("Transfers via %s %s:", target.name, target.url)
+		writeSizeResults(env, transfers)
+		largest, failed := largestWorking(transfers)
+		switch {
+		case transfers[0].failure != "":
+			problems = append(problems, fmt.Sprintf("%s: even %s transfers fail: %s", target.name, formatSize(transfers[0].size), transfers[0].failure))
+		case failed > 0:
+			problems = append(problems, fmt.Sprintf("%s: transfers up to %s work but %s fail, a likely fragmentation blackhole",
+				target.name, formatSize(largest), formatSize(failed)))
+		default:
+			env.Notef("%s: up to %s", target.name, formatSize(largest))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// pingSizesFrom runs netperf ping in the pod to ping ip once per size of
+// pingSizes that fits mtu, and with the largest payload that fits. When the
+// pod may not send ICMP, every size fails with that reason.
+func pingSizesFrom(ctx context.Context, env *check.Env, namespace, pod, ip string, mtu int) ([]sizeResult, error) {
+	largest := mtu - icmpOverhead[ipFamily(ip)]
+	var sizes []int
+	for _, size := range pingSizes {
+		if size < largest {
+			sizes = append(sizes, size)
+		}
+	}
+	sizes = append(sizes, largest)
+
+	command := []string{"netperf", "ping", "--timeout", pingTimeout.String(), ip}
+	for _, size := range sizes {
+		command = append(command, strconv.Itoa(size))
+	}
+	stdout, stderr, err := env.Exec(ctx, namespace, pod, command...)
+	if err != nil {
+		reason := strings.ToLower(stderr)
+		if !strings.Contains(reason, "permission denied") && !strings.Contains(reason, "operation not permitted") {
+			return nil, fmt.Errorf("failed to exec in pod %s: %w (%s)", pod, err, strings.TrimSpace(stderr))
+		}
+		results := make([]sizeResult, len(sizes))
+		for i, size := range sizes {
+			results[i] = sizeResult{size: size, failure: "no permission to send ICMP"}
+		}
+		return results, nil
+	}
+
+	var results []sizeResult
+	decoder := json.NewDecoder(strings.NewReader(stdout))
+	for decoder.More() {
+		var ping netperf.PingResult
+		if err := decoder.Decode(&ping); err != nil {
+			return nil, fmt.Errorf("unexpected ping output in pod %s: %q", pod, stdout)
+		}
+		result := sizeResult{size: ping.Size, latency: ping.RTT}
+		if !ping.Replied {
+			result.failure = ping.Error
+		}
+		results = append(results, result)
+	}
+	if len(results) != len(sizes) {
+		return nil, fmt.Errorf("pod %s reported %d of %d ping sizes", pod, len(results), len(sizes))
+	}
+	return results, nil
+}
+
+// transferSizes downloads every payload size from base and checks that all
+// bytes arrive.
+func transferSizes(ctx context.Context, env *check.Env, namespace, pod, base string) ([]sizeResult, error) {
+	sizes := make([]string, len(payloadSizes))
+	for i, size := range payloadSizes {
+		sizes[i] = strconv.Itoa(size)
+	}
+	// Each size prints "<size> <bytes received> <nanoseconds>".
+	script := fmt.Sprintf(`for s in %s; do `+
+		`start=$(date +%%s%%N); n=$(wget -q -O - -T %d '%spayload-'$s 2>/dev/null | wc -c); end=$(date +%%s%%N); `+
+		`echo "$s $((n)) $((end-start))"; done`,
+		strings.Join(sizes, " "), int(probeTimeout.Seconds()), base)
+	return runSizeScript(ctx, env, namespace, pod, script, len(sizes), func(size int, received, _ string) string {
+		if received != strconv.Itoa(size) {
+			return fmt.Sprintf("%s of %d bytes received", received, size)
+		}
+		return ""
+	})
+}
+
+// runSizeScript runs script in the pod and parses its "<size> <status>
+// <nanoseconds> [output]" lines, one per size. classify returns why a size
+// failed, or "" when it worked.
+func runSizeScript(ctx context.Context, env *check.Env, namespace, pod, script string, count int, classify func(size int, status, output string) string) ([]sizeResult, error) {
+	stdout, stderr, err := env.Exec(ctx, namespace, pod, "sh", "-c", script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exec in pod %s: %w (%s)", pod, err, strings.TrimSpace(stderr))
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != count {
+		return nil, fmt.Errorf("unexpected output from pod %s: %q", pod, stdout)
+	}
+	results := make([]sizeResult, len(lines))
+	for i, line := range lines {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected output from pod %s: %q", pod, line)
+		}
+		size, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected output from pod %s: %q", pod, line)
+		}
+		nanos, _ := strconv.ParseInt(fields[2], 10, 64)
+		output := ""
+		if len(fields) == 4 {
+			output = strings.TrimSpace(fields[3])
+		}
+		results[i] = sizeResult{size: size, latency: time.Duration(nanos), failure: classify(size, fields[1], output)}
+	}
+	return results, nil
+}
+
+// largestWorking returns the largest size that worked before the first
+// failure, and the size that failed, or 0 when every size worked.
+func largestWorking(results []sizeResult) (largest, failed int) {
+	for _, result := range results {
+		if result.failure != "" {
+			return largest, result.size
+		}
+		largest = result.size
+	}
+	return largest, 0
+}
+
+// writeSizeResults adds one line per size to the details.
+func writeSizeResults(env *check.Env, results []sizeResult) {
+	for _, result := range results {
+		outcome := "ok"
+		if result.failure != "" {
+			outcome = result.failure
+		}
+		env.Detailf("  %8s  %-10s %s", formatSize(result.size), result.latency.Round(time.Millisecond), outcome)
+	}
+}
+
+// formatSize formats a byte count using KiB or MiB when exact.
+func formatSize(size int) string {
+	switch {
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", size>>10)
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
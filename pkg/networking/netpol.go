@@ -0,0 +1,298 @@
+package networking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const (
+	// accessLabel marks clients the allow policy admits.
+	accessLabel = "ktest.io/access"
+	// peerLabel marks the peer namespace the allow policy admits clients
+	// from.
+	peerLabel = "ktest.io/netpol-peer"
+)
+
+// policyPath is a request whose outcome the policies decide.
+type policyPath struct {
+	name      string
+	namespace string
+	client    string
+	url       string
+	allowed   bool
+}
+
+// pathOutcome is what happened to a policyPath's request.
+type pathOutcome struct {
+	latency time.Duration
+	err     error
+}
+
+// blocked reports whether a request was stopped by a policy: policies drop
+// packets, so the request times out, though some CNIs reject them instead.
+func (o pathOutcome) blocked() bool {
+	var probeErr *ProbeError
+	return errors.As(o.err, &probeErr) && (probeErr.Reason == ReasonTimeout || probeErr.Reason == ReasonRefused)
+}
+
+func (o pathOutcome) String() string {
+	var probeErr *ProbeError
+	switch {
+	case o.err == nil:
+		return fmt.Sprintf("allowed (%s)", o.latency.Round(time.Microsecond))
+	case errors.As(o.err, &probeErr) && o.blocked():
+		return "blocked (" + probeErr.Reason + ")"
+	default:
+		return o.err.Error()
+	}
+}
+
+// TestNetworkPolicy checks that the CNI enforces NetworkPolicy. It starts a
+// server, an unrelated target pod and clients, checks that every client can
+// reach both before any policy exists, then applies:
+//
+//   - a default-deny ingress policy for the server,
+//   - an allow policy admitting labelled clients from the test namespace and
+//     labelled clients from a labelled peer namespace,
+//   - an egress policy only letting one client reach the server.
+//
+// It then waits until every allowed request succeeds and every denied request
+// is blocked, and reports how long enforcement took.
+func TestNetworkPolicy(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	// The peer namespace admitted by the allow policy's namespaceSelector.
+	peerNamespace := env.Name("ktest-peer")
+	peer := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   peerNamespace,
+			Labels: env.Labels(map[string]string{peerLabel: "true"}),
+		},
+	}
+	if _, err := clientset.CoreV1().Namespaces().Create(ctx, peer, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create peer namespace: %w", err)
+	}
+	defer env.Cleanup("namespace", peerNamespace, func(ctx context.Context) error {
+		return clientset.CoreV1().Namespaces().Delete(ctx, peerNamespace, metav1.DeleteOptions{})
+	})
+
+	// Every selector includes the run ID so that policies never affect pods
+	// of other runs sharing the namespace.
+	serverLabels := env.Selector("netpol-server")
+	allowed := env.Labels(map[string]string{accessLabel: "allowed"})
+	egressLabels := env.Labels(map[string]string{accessLabel: "allowed", "role": "egress-client"})
+
+	server := newServerPod(env, namespace, env.Name("netpol-server"), serverLabels)
+	other := newServerPod(env, namespace, env.Name("netpol-other"), env.Selector("netpol-other"))
+	allowedClient := newClientPod(env, namespace, env.Name("netpol-allowed"), allowed)
+	deniedClient := newClientPod(env, namespace, env.Name("netpol-denied"), nil)
+	egressClient := newClientPod(env, namespace, env.Name("netpol-egress"), egressLabels)
+	peerAllowed := newClientPod(env, peerNamespace, env.Name("netpol-peer-allowed"), allowed)
+	peerDenied := newClientPod(env, peerNamespace, env.Name("netpol-peer-denied"), nil)
+
+	pods := []*corev1.Pod{server, other, allowedClient, deniedClient, egressClient, peerAllowed, peerDenied}
+	deletePods, err := createPods(ctx, env, pods...)
+	defer deletePods()
+	if err != nil {
+		return err
+	}
+
+	ips := map[string]string{}
+	for _, pod := range pods {
+		running, err := waitForPodRunning(ctx, env, pod.Namespace, pod.Name)
+		if err != nil {
+			return err
+		}
+		ips[pod.Name] = running.Status.PodIP
+	}
+
+	path := func(name string, client *corev1.Pod, target *corev1.Pod, allowed bool) policyPath {
+		return policyPath{
+			name:      name,
+			namespace: client.Namespace,
+			client:    client.Name,
+			url:       httpURL(ips[target.Name], backendPort),
+			allowed:   allowed,
+		}
+	}
+	paths := []policyPath{
+		path("labelled client -> server", allowedClient, server, true),
+		path("unlabelled client -> server", deniedClient, server, false),
+		path("labelled client in peer namespace -> server", peerAllowed, server, true),
+		path("unlabelled client in peer namespace -> server", peerDenied, server, false),
+		path("egress-restricted client -> server", egressClient, server, true),
+		path("egress-restricted client -> other pod", egressClient, other, false),
+		path("unlabelled client -> other pod", deniedClient, other, true),
+	}
+
+	// Without policies every path must work, or a blocked request would not
+	// prove anything.
+	outcomes, err := probePaths(ctx, env, paths)
+	if err != nil {
+		return err
+	}
+	for i, p := range paths {
+		if outcomes[i].err != nil {
+			return fmt.Errorf("%s fails before any policy is applied: %w", p.name, outcomes[i].err)
+		}
+	}
+
+	for _, policy := range networkPolicies(env, namespace, serverLabels, egressLabels) {
+		if _, err := clientset.NetworkingV1().NetworkPolicies(namespace).Create(ctx, policy, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create network policy: %w", err)
+		}
+		name := policy.Name
+		defer env.Cleanup("networkpolicy", name, func(ctx context.Context) error {
+			return clientset.NetworkingV1().NetworkPolicies(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		})
+	}
+
+	// Policies are enforced asynchronously, so probe until every path
+	// behaves as expected.
+	start := time.Now()
+	var wrong int
+	err = wait.PollUntilContextTimeout(ctx, time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			current, err := probePaths(ctx, env, paths)
+			if err != nil {
+				return false, err
+			}
+			outcomes = current
+			wrong = 0
+			for i, p := range paths {
+				if (p.allowed && outcomes[i].err != nil) || (!p.allowed && !outcomes[i].blocked()) {
+					wrong++
+				}
+			}
+			return wrong == 0, nil
+		})
+
+	for i, p := range paths {
+		expected := "allowed"
+		if !p.allowed {
+			expected = "blocked"
+		}
+		env.Detailf("%-48s expected %s, got %s", p.name, expected, outcomes[i])
+	}
+	if err != nil {
+		if wait.Interrupted(err) && ctx.Err() == nil {
+			return fmt.Errorf("network policies not enforced after %s: %d of %d paths behave wrongly (does the CNI support NetworkPolicy?)",
+				env.Timeout(), wrong, len(paths))
+		}
+		return err
+	}
+	env.Notef("%d paths allowed or blocked as expected, enforced within %s", len(paths), time.Since(start).Round(time.Second))
+
+	return nil
+}
+
+// networkPolicies returns the default-deny, allow and egress policies.
+func networkPolicies(env *check.Env, namespace string, server, egressClient map[string]string) []*networkingv1.NetworkPolicy {
+	port := intstr.FromInt(backendPort)
+	tcp := corev1.ProtocolTCP
+	ports := []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}}
+	allowed := env.Labels(map[string]string{accessLabel: "allowed"})
+	// Only admit this run's peer namespace.
+	peer := env.Labels(map[string]string{peerLabel: "true"})
+
+	meta := func(prefix string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: env.Name(prefix), Namespace: namespace, Labels: env.Labels(nil)}
+	}
+	return []*networkingv1.NetworkPolicy{
+		{
+			ObjectMeta: meta("netpol-deny"),
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: server},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		},
+		{
+			ObjectMeta: meta("netpol-allow"),
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: server},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{
+					{
+						Ports: ports,
+						From: []networkingv1.NetworkPolicyPeer{
+							// Labelled pods in the policy's namespace.
+							{PodSelector: &metav1.LabelSelector{MatchLabels: allowed}},
+							// Labelled pods in the peer namespace.
+							{
+								NamespaceSelector: &metav1.LabelSelector{MatchLabels: peer},
+								PodSelector:       &metav1.LabelSelector{MatchLabels: allowed},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: meta("netpol-egress"),
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: egressClient},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Egress: []networkingv1.NetworkPolicyEgressRule{
+					{
+						Ports: ports,
+						To:    []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: server}}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// probePaths sends every path's request, with one exec per client running
+// concurrently.
+func probePaths(ctx context.Context, env *check.Env, paths []policyPath) ([]pathOutcome, error) {
+	type client struct{ namespace, name string }
+	byClient := map[client][]int{}
+	for i, p := range paths {
+		c := client{p.namespace, p.client}
+		byClient[c] = append(byClient[c], i)
+	}
+
+	outcomes := make([]pathOutcome, len(paths))
+	errs := make(chan error, len(byClient))
+	var wg sync.WaitGroup
+	for c, indexes := range byClient {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			urls := make([]string, len(indexes))
+			for k, i := range indexes {
+				urls[k] = paths[i].url
+			}
+			results, err := probeHTTPAll(ctx, env, c.namespace, c.name, urls)
+			if err != nil {
+				errs <- err
+				return
+			}
+			for k, i := range indexes {
+				outcomes[i] = pathOutcome{latency: results[k].Latency, err: results[k].Err}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return outcomes, nil
+}
@@ -0,0 +1,156 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const (
+	clientImage = "busybox:latest"
+	serverImage = "nginx:alpine"
+	// routedPath is a second path test servers answer on, so that ingress
+	// checks can route it to another service.
+	routedPath = "/ktest/"
+)
+
+// podStartFailures are container waiting reasons that will not resolve by
+// waiting longer.
+var podStartFailures = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CrashLoopBackOff":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// httpdContainer returns a busybox container serving a page with the pod's
+// hostname on port, at / and at routedPath, ready once it answers.
+func httpdContainer(port int) corev1.Container {
+	script := fmt.Sprintf("mkdir -p /www%[1]s && hostname > /www/index.html && hostname > /www%[1]sindex.html && exec httpd -f -p %[2]d -h /www",
+		routedPath, port)
+	return corev1.Container{
+		Name:    "httpd",
+		Image:   clientImage,
+		Command: []string{"sh", "-c", script},
+		Ports:   []corev1.ContainerPort{{ContainerPort: int32(port)}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{Path: "/", Port: intstr.FromInt(port)},
+			},
+			PeriodSeconds: 2,
+		},
+	}
+}
+
+// waitForPodRunning waits until all containers of a pod are running and ready
+// and returns the pod. It gives up early when the pod cannot start.
+func waitForPodRunning(ctx context.Context, env *check.Env, namespace, name string) (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	err := wait.PollUntilContextTimeout(ctx, 1*time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			var err error
+			pod, err = env.Clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			switch pod.Status.Phase {
+			case corev1.PodRunning:
+				return podReady(pod), nil
+			case corev1.PodSucceeded, corev1.PodFailed:
+				return false, fmt.Errorf("pod exited with phase %s", pod.Status.Phase)
+			}
+			return false, podStartError(pod)
+		})
+	if err != nil {
+		return nil, fmt.Errorf("pod %s is not running: %w", name, err)
+	}
+	return pod, nil
+}
+
+// podStartError returns an error if a container of pod is stuck in a state
+// that waiting will not fix.
+func podStartError(pod *corev1.Pod) error {
+	for _, status := range pod.Status.ContainerStatuses {
+		if w := status.State.Waiting; w != nil && podStartFailures[w.Reason] {
+			return fmt.Errorf("container %s of pod %s cannot start: %s: %s", status.Name, pod.Name, w.Reason, w.Message)
+		}
+	}
+	return nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// deletePod returns a function deleting a pod, for use with env.Cleanup.
+func deletePod(env *check.Env, namespace, name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return env.Clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+}
+
+// newClientPod returns a busybox pod that idles so commands can be run in it.
+func newClientPod(env *check.Env, namespace, name string, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    env.Labels(labels),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "client",
+					Image:   clientImage,
+					Command: []string{"sh", "-c", "sleep 3600"},
+				},
+			},
+		},
+	}
+}
+
+// newServerPod returns a pod serving its name over HTTP on backendPort.
+func newServerPod(env *check.Env, namespace, name string, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    env.Labels(labels),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{httpdContainer(backendPort)},
+		},
+	}
+}
+
+// createPods creates pods and returns a function deleting the ones that were
+// created. Defer it even when an error is returned.
+func createPods(ctx context.Context, env *check.Env, pods ...*corev1.Pod) (func(), error) {
+	var created []*corev1.Pod
+	cleanup := func() {
+		for _, pod := range created {
+			env.Cleanup("pod", pod.Name, deletePod(env, pod.Namespace, pod.Name))
+		}
+	}
+	for _, pod := range pods {
+		if _, err := env.Clientset.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			return cleanup, fmt.Errorf("failed to create pod %s: %w", pod.Name, err)
+		}
+		created = append(created, pod)
+	}
+	return cleanup, nil
+}
@@ -0,0 +1,195 @@
+package networking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+// probeTimeout bounds a single connection attempt from a client pod.
+const probeTimeout = 5 * time.Second
+
+// Reasons a probe can fail for.
+const (
+	ReasonTimeout     = "timeout"
+	ReasonRefused     = "connection refused"
+	ReasonNoRoute     = "no route to host"
+	ReasonUnresolved  = "name resolution failed"
+	ReasonUnreachable = "network unreachable"
+	ReasonFailed      = "failed"
+)
+
+// ProbeError is returned when a client pod could not reach a target.
+type ProbeError struct {
+	// Target is the URL that was requested.
+	Target string
+	// Reason classifies the failure, e.g. ReasonTimeout.
+	Reason string
+	// Output is what the client printed.
+	Output string
+}
+
+func (e *ProbeError) Error() string {
+	if e.Output == "" {
+		return fmt.Sprintf("%s: %s", e.Target, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Target, e.Reason, e.Output)
+}
+
+// failureReasons maps busybox wget error text to a probe failure reason.
+var failureReasons = []struct {
+	text   string
+	reason string
+}{
+	{"timed out", ReasonTimeout},
+	{"Connection refused", ReasonRefused},
+	{"No route to host", ReasonNoRoute},
+	{"Host is unreachable", ReasonNoRoute},
+	{"Network is unreachable", ReasonUnreachable},
+	{"bad address", ReasonUnresolved},
+}
+
+func classifyProbeFailure(output string) string {
+	for _, f := range failureReasons {
+		if strings.Contains(output, f.text) {
+			return f.reason
+		}
+	}
+	return ReasonFailed
+}
+
+// httpURL returns the URL for port on host, bracketing IPv6 addresses.
+func httpURL(host string, port int) string {
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port)) + "/"
+}
+
+// probeResult is the outcome of one request from a client pod.
+type probeResult struct {
+	URL string
+	// Latency is how long the request took, as measured inside the pod.
+	Latency time.Duration
+	// Body is the response body with newlines replaced by spaces.
+	Body string
+	// Err is a *ProbeError when the request failed.
+	Err error
+}
+
+// probeHTTP requests url with wget from the busybox client pod and returns
+// how long the request took.
+func probeHTTP(ctx context.Context, env *check.Env, namespace, clientPod, url string) (time.Duration, error) {
+	results, err := probeHTTPAll(ctx, env, namespace, clientPod, []string{url})
+	if err != nil {
+		return 0, err
+	}
+	return results[0].Latency, results[0].Err
+}
+
+// probeHTTPAll requests each URL in turn from the busybox client pod in a
+// single exec. Latencies are measured inside the pod because the exec round
+// trip through the API server would dwarf them. An error means the probes
+// could not be run at all.
+func probeHTTPAll(ctx context.Context, env *check.Env, namespace, clientPod string, urls []string) ([]probeResult, error) {
+	return probeVirtualHost(ctx, env, namespace, clientPod, "", urls)
+}
+
+// probeVirtualHost is probeHTTPAll sending host as the Host header of every
+// request, unless it is empty.
+func probeVirtualHost(ctx context.Context, env *check.Env, namespace, clientPod, host string, urls []string) ([]probeResult, error) {
+	header := ""
+	if host != "" {
+		header = "--header 'Host: " + host + "' "
+	}
+	quoted := make([]string, len(urls))
+	for i, url := range urls {
+		quoted[i] = "'" + url + "'"
+	}
+	// Each request prints "<url> <exit code> <nanoseconds> <output>", where
+	// output is the response body or wget's error.
+	script := fmt.Sprintf(`for u in %s; do `+
+		`start=$(date +%%s%%N); out=$(wget -q -O - -T %d %s"$u" 2>&1); rc=$?; end=$(date +%%s%%N); `+
+		`echo "$u $rc $((end-start)) $(echo "$out" | tr '\n' ' ')"; done`,
+		strings.Join(quoted, " "), int(probeTimeout.Seconds()), header)
+
+	stdout, stderr, err := env.Exec(ctx, namespace, clientPod, "sh", "-c", script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exec in pod %s: %w (%s)", clientPod, err, strings.TrimSpace(stderr))
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != len(urls) {
+		return nil, fmt.Errorf("unexpected probe output from pod %s: %q", clientPod, stdout)
+	}
+	results := make([]probeResult, len(urls))
+	for i, line := range lines {
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 3 || fields[0] != urls[i] {
+			return nil, fmt.Errorf("unexpected probe output from pod %s: %q", clientPod, line)
+		}
+		results[i].URL = urls[i]
+		if ns, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+			results[i].Latency = time.Duration(ns)
+		}
+		output := ""
+		if len(fields) == 4 {
+			output = strings.TrimSpace(fields[3])
+		}
+		if fields[1] != "0" {
+			results[i].Err = &ProbeError{Target: urls[i], Reason: classifyProbeFailure(output), Output: output}
+		} else {
+			results[i].Body = output
+		}
+	}
+	return results, nil
+}
+
+// probeFromHost requests url from the machine running ktest, for services
+// that should be reachable from outside the cluster.
+func probeFromHost(ctx context.Context, url string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, &ProbeError{Target: url, Reason: classifyHostFailure(err), Output: err.Error()}
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, &ProbeError{Target: url, Reason: classifyHostFailure(err), Output: err.Error()}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, &ProbeError{Target: url, Reason: ReasonFailed, Output: resp.Status}
+	}
+	return time.Since(start), nil
+}
+
+func classifyHostFailure(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return ReasonUnresolved
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReasonRefused
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return ReasonNoRoute
+	case errors.Is(err, syscall.ENETUNREACH):
+		return ReasonUnreachable
+	}
+	return ReasonFailed
+}
@@ -0,0 +1,282 @@
+package networking
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+// defaultClusterDomain is assumed when a pod's search path does not reveal
+// the cluster domain.
+const defaultClusterDomain = "cluster.local"
+
+// resolvConf is the resolver configuration of a pod.
+type resolvConf struct {
+	nameservers []string
+	search      []string
+	ndots       int
+}
+
+// readResolvConf reads /etc/resolv.conf in a pod.
+func readResolvConf(ctx context.Context, env *check.Env, namespace, pod string) (*resolvConf, error) {
+	stdout, stderr, err := env.Exec(ctx, namespace, pod, "cat", "/etc/resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /etc/resolv.conf in pod %s: %w (%s)", pod, err, strings.TrimSpace(stderr))
+	}
+	return parseResolvConf(stdout), nil
+}
+
+func parseResolvConf(content string) *resolvConf {
+	conf := &resolvConf{ndots: 1}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			conf.nameservers = append(conf.nameservers, fields[1])
+		case "search":
+			conf.search = fields[1:]
+		case "options":
+			for _, option := range fields[1:] {
+				if value, ok := strings.CutPrefix(option, "ndots:"); ok {
+					if n, err := strconv.Atoi(value); err == nil {
+						conf.ndots = n
+					}
+				}
+			}
+		}
+	}
+	return conf
+}
+
+// clusterDomain derives the cluster domain from the "<namespace>.svc.<domain>"
+// search entry kubelet writes for pods.
+func (c *resolvConf) clusterDomain(namespace string) string {
+	prefix := namespace + ".svc."
+	for _, domain := range c.search {
+		if strings.HasPrefix(domain, prefix) {
+			return strings.TrimPrefix(domain, prefix)
+		}
+	}
+	return defaultClusterDomain
+}
+
+// LookupError is returned when a DNS query from a pod gets no answer.
+type LookupError struct {
+	Name   string
+	Type   string
+	Output string
+}
+
+func (e *LookupError) Error() string {
+	return fmt.Sprintf("%s lookup of %s failed: %s", e.Type, e.Name, e.Output)
+}
+
+// dnsRecord is an answer parsed from nslookup output.
+type dnsRecord struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// nslookup queries name for records of qtype (A, AAAA, SRV, CNAME, ...) with
+// busybox nslookup in pod. It returns the parsed answers and the raw resolver
+// output; a query without answers returns a *LookupError.
+func nslookup(ctx context.Context, env *check.Env, namespace, pod, qtype, name string) ([]dnsRecord, string, error) {
+	stdout, stderr, err := env.Exec(ctx, namespace, pod, "nslookup", "-type="+strings.ToLower(qtype), name)
+	output := strings.TrimSpace(stdout + stderr)
+	if err != nil {
+		var exitErr utilexec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, output, fmt.Errorf("failed to exec in pod %s: %w", pod, err)
+		}
+		return nil, output, &LookupError{Name: name, Type: qtype, Output: compact(output)}
+	}
+
+	records := parseNslookup(stdout)
+	if len(records) == 0 {
+		return nil, output, &LookupError{Name: name, Type: qtype, Output: compact(output)}
+	}
+	return records, output, nil
+}
+
+// parseNslookup parses the answers in busybox nslookup output, skipping the
+// "Server:" header. Addresses become A or AAAA records, "service = priority
+// weight port target" lines SRV records valued "port target", and "canonical
+// name = target" lines CNAME records. Names lose their trailing dot.
+func parseNslookup(output string) []dnsRecord {
+	var records []dnsRecord
+	name := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Name:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "Name:"))
+		case strings.HasPrefix(line, "Address") && name != "":
+			// "Address: 10.96.0.1", or "Address 1: 10.96.0.1 name" from
+			// older busybox.
+			_, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				continue
+			}
+			ip := net.ParseIP(fields[0])
+			if ip == nil {
+				continue
+			}
+			recordType := "AAAA"
+			if ip.To4() != nil {
+				recordType = "A"
+			}
+			records = append(records, dnsRecord{Name: name, Type: recordType, Value: ip.String()})
+		case strings.Contains(line, "service = "):
+			owner, value, _ := strings.Cut(line, "service = ")
+			fields := strings.Fields(value)
+			if len(fields) != 4 {
+				continue
+			}
+			// Priority and weight are up to the DNS server.
+			records = append(records, dnsRecord{
+				Name:  strings.TrimSpace(owner),
+				Type:  "SRV",
+				Value: fields[2] + " " + strings.TrimSuffix(fields[3], "."),
+			})
+		case strings.Contains(line, "canonical name = "):
+			owner, value, _ := strings.Cut(line, "canonical name = ")
+			records = append(records, dnsRecord{
+				Name:  strings.TrimSpace(owner),
+				Type:  "CNAME",
+				Value: strings.TrimSuffix(strings.TrimSpace(value), "."),
+			})
+		}
+	}
+	return records
+}
+
+// dnsClient is a pod DNS queries are sent from.
+type dnsClient struct {
+	namespace string
+	pod       string
+	conf      *resolvConf
+	// domain is the cluster domain, e.g. cluster.local.
+	domain string
+}
+
+// startDNSClient starts a busybox pod in namespace and reads its resolver
+// configuration. The returned cleanup must be called even on error.
+func startDNSClient(ctx context.Context, env *check.Env, namespace string) (*dnsClient, func(), error) {
+	name := env.Name("dns-client")
+	cleanup, err := createPods(ctx, env, newClientPod(env, namespace, name, nil))
+	if err != nil {
+		return nil, cleanup, err
+	}
+	if _, err := waitForPodRunning(ctx, env, namespace, name); err != nil {
+		return nil, cleanup, err
+	}
+	conf, err := readResolvConf(ctx, env, namespace, name)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	return &dnsClient{namespace: namespace, pod: name, conf: conf, domain: conf.clusterDomain(namespace)}, cleanup, nil
+}
+
+// serviceName returns the fully qualified DNS name of a service.
+func (c *dnsClient) serviceName(service, namespace string) string {
+	return service + "." + namespace + ".svc." + c.domain
+}
+
+// expect queries name for qtype records until the answers are exactly want,
+// in any order, or any answer when want is empty, and returns the answering
+// records. Records appear some time after their objects are created, so it
+// retries until the timeout and then fails with the last resolver output.
+func (c *dnsClient) expect(ctx context.Context, env *check.Env, qtype, name string, want ...string) ([]dnsRecord, error) {
+	if qtype == "A" || qtype == "AAAA" {
+		want = slices.Clone(want)
+		for i, ip := range want {
+			if parsed := net.ParseIP(ip); parsed != nil {
+				want[i] = parsed.String()
+			}
+		}
+	}
+	var records []dnsRecord
+	var answers []string
+	var output string
+	var lookupErr error
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			var all []dnsRecord
+			all, output, lookupErr = nslookup(ctx, env, c.namespace, c.pod, qtype, name)
+			var notFound *LookupError
+			if errors.As(lookupErr, &notFound) {
+				return false, nil
+			}
+			if lookupErr != nil {
+				return false, lookupErr
+			}
+			records, answers = nil, nil
+			for _, record := range all {
+				if record.Type == qtype {
+					records = append(records, record)
+					answers = append(answers, record.Value)
+				}
+			}
+			if len(want) == 0 {
+				return len(answers) > 0, nil
+			}
+			return sameValues(answers, want), nil
+		})
+	if err == nil {
+		return records, nil
+	}
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	if !wait.Interrupted(err) || ctx.Err() != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", name, err)
+	}
+	if len(answers) == 0 {
+		return nil, fmt.Errorf("%s lookup of %s returned no %s records; resolver output: %s",
+			qtype, name, qtype, compact(output))
+	}
+	return nil, fmt.Errorf("%s lookup of %s answered %s, expected %s; resolver output: %s",
+		qtype, name, strings.Join(answers, ", "), strings.Join(want, ", "), compact(output))
+}
+
+// sameValues reports whether a and b hold the same values in any order.
+func sameValues(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// addressType returns the record type holding ip.
+func addressType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
+
+// compact joins multi-line resolver output into one line for messages.
+func compact(output string) string {
+	return strings.Join(strings.Fields(output), " ")
+}
@@ -0,0 +1,265 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const (
+	// backendPort is where service backend pods listen.
+	backendPort = 8080
+	// defaultBackends is how many backend pods the service gets when no
+	// replicas are configured.
+	defaultBackends = 3
+	// requestsPerBackend is how many requests are sent through the service
+	// per backend to check that load is spread across all of them.
+	requestsPerBackend = 10
+)
+
+// serviceFixture is a service in front of busybox httpd backend pods that
+// answer with their pod name, plus a client pod to send requests from.
+type serviceFixture struct {
+	service  *corev1.Service
+	backends []string
+	client   string
+	// endpointDelay is the longest a backend took to become a ready
+	// endpoint after its pod became ready.
+	endpointDelay time.Duration
+}
+
+// startServiceFixture creates a service with backends and a client pod and
+// waits until every backend is a ready endpoint and the client is running.
+// configure may adjust the service spec, e.g. its type. The returned function
+// deletes everything and must be deferred even when an error is returned.
+func startServiceFixture(ctx context.Context, env *check.Env, namespace string, configure func(*corev1.ServiceSpec)) (*serviceFixture, func(), error) {
+	clientset := env.Clientset
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
+	backends := int(env.Settings.Replicas)
+	if backends <= 0 {
+		backends = defaultBackends
+	}
+
+	// Select by the unique service name so that fixtures started by one
+	// check do not share backends.
+	serviceName := env.Name("test-service")
+	selector := env.Selector(serviceName)
+
+	// Create service
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serviceName,
+			Namespace: namespace,
+			Labels:    env.Labels(nil),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: selector,
+			Ports: []corev1.ServicePort{
+				{
+					Port:       80,
+					TargetPort: intstr.FromInt(backendPort),
+				},
+			},
+		},
+	}
+	if configure != nil {
+		configure(&service.Spec)
+	}
+
+	service, err := clientset.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("failed to create service: %w", err)
+	}
+	cleanups = append(cleanups, func() {
+		env.Cleanup("service", serviceName, func(ctx context.Context) error {
+			return clientset.CoreV1().Services(namespace).Delete(ctx, serviceName, metav1.DeleteOptions{})
+		})
+	})
+
+	// Create the backends, each answering with its hostname, and a client
+	f := &serviceFixture{service: service, client: env.Name("service-client")}
+	var pods []*corev1.Pod
+	for i := 0; i < backends; i++ {
+		name := env.Name("test-service-backend")
+		pods = append(pods, newServerPod(env, namespace, name, selector))
+		f.backends = append(f.backends, name)
+	}
+	pods = append(pods, newClientPod(env, namespace, f.client, nil))
+	deletePods, err := createPods(ctx, env, pods...)
+	cleanups = append(cleanups, deletePods)
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	f.endpointDelay, err = waitForEndpoints(ctx, env, namespace, serviceName, selector, f.backends)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	if _, err := waitForPodRunning(ctx, env, namespace, f.client); err != nil {
+		return nil, cleanup, err
+	}
+	return f, cleanup, nil
+}
+
+// TestServiceConnectivity starts backend pods behind a ClusterIP service,
+// waits for them to become ready endpoints and then requests pages through
+// the ClusterIP and the service DNS name from a client pod. It fails unless
+// every request succeeds and every backend answers, and reports how long
+// endpoints took to become ready after their pods.
+func TestServiceConnectivity(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	f, cleanup, err := startServiceFixture(ctx, env, namespace, nil)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	service := f.service
+	if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == corev1.ClusterIPNone {
+		return fmt.Errorf("service %s has no cluster IP", service.Name)
+	}
+
+	targets := []struct {
+		name string
+		url  string
+	}{
+		{"ClusterIP", httpURL(service.Spec.ClusterIP, 80)},
+		{"DNS name", httpURL(service.Name+"."+namespace+".svc", 80)},
+	}
+	for _, target := range targets {
+		hits, err := requestSpread(ctx, env, namespace, f.client, target.url, len(f.backends)*requestsPerBackend, f.backends)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", target.name, target.url, err)
+		}
+		env.Notef("%s: %s", target.name, hits)
+	}
+	env.Notef("endpoints ready up to %s after their pods", f.endpointDelay.Round(10*time.Millisecond))
+
+	return nil
+}
+
+// waitForEndpoints waits until every backend pod is a ready endpoint in the
+// service's EndpointSlices and returns the longest time an endpoint took to
+// become ready after its pod did. Both are observed by polling, so the delay
+// is accurate to the poll interval.
+func waitForEndpoints(ctx context.Context, env *check.Env, namespace, service string, selector map[string]string, backends []string) (time.Duration, error) {
+	podReadyAt := map[string]time.Time{}
+	endpointReadyAt := map[string]time.Time{}
+	podSelector := labels.SelectorFromSet(selector).String()
+	sliceSelector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service}).String()
+
+	err := wait.PollUntilContextTimeout(ctx, 250*time.Millisecond, env.Timeout(), true,
+		func(ctx context.Context) (bool, error) {
+			now := time.Now()
+			pods, err := env.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: podSelector})
+			if err != nil {
+				return false, err
+			}
+			for _, pod := range pods.Items {
+				if err := podStartError(&pod); err != nil {
+					return false, err
+				}
+				if _, seen := podReadyAt[pod.Name]; !seen && pod.Status.Phase == corev1.PodRunning && podReady(&pod) {
+					podReadyAt[pod.Name] = now
+				}
+			}
+
+			slices, err := env.Clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{LabelSelector: sliceSelector})
+			if err != nil {
+				return false, err
+			}
+			for _, slice := range slices.Items {
+				for _, endpoint := range slice.Endpoints {
+					// A nil ready condition means ready.
+					ready := endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+					if endpoint.TargetRef == nil || !ready {
+						continue
+					}
+					if _, seen := endpointReadyAt[endpoint.TargetRef.Name]; !seen {
+						endpointReadyAt[endpoint.TargetRef.Name] = now
+					}
+				}
+			}
+
+			for _, name := range backends {
+				if _, ok := endpointReadyAt[name]; !ok {
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	if err != nil {
+		return 0, fmt.Errorf("%d of %d backends became ready endpoints of service %s: %w", len(endpointReadyAt), len(backends), service, err)
+	}
+
+	var delay time.Duration
+	for _, name := range backends {
+		// An endpoint seen before its pod was ready counts as no delay.
+		if podReady, ok := podReadyAt[name]; ok && endpointReadyAt[name].Sub(podReady) > delay {
+			delay = endpointReadyAt[name].Sub(podReady)
+		}
+	}
+	return delay, nil
+}
+
+// requestSpread sends count requests to url from the client pod and checks
+// that all succeed and every backend answers at least once. It returns how
+// the requests were spread, e.g. "30 requests, spread 9/11/10".
+func requestSpread(ctx context.Context, env *check.Env, namespace, clientPod, url string, count int, backends []string) (string, error) {
+	results, err := probeHTTPAll(ctx, env, namespace, clientPod, repeat(url, count))
+	if err != nil {
+		return "", err
+	}
+
+	hits := map[string]int{}
+	for _, name := range backends {
+		hits[name] = 0
+	}
+	var failures []error
+	for _, result := range results {
+		if result.Err != nil {
+			failures = append(failures, result.Err)
+			continue
+		}
+		if _, ok := hits[result.Body]; !ok {
+			return "", fmt.Errorf("unexpected response %q", result.Body)
+		}
+		hits[result.Body]++
+	}
+	if len(failures) > 0 {
+		return "", fmt.Errorf("%d of %d requests failed, first: %w", len(failures), count, failures[0])
+	}
+
+	spread := make([]string, len(backends))
+	var missing []string
+	for i, name := range backends {
+		spread[i] = strconv.Itoa(hits[name])
+		if hits[name] == 0 {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%d requests never reached backends %s", count, strings.Join(missing, ", "))
+	}
+	return fmt.Sprintf("%d requests, spread %s", count, strings.Join(spread, "/")), nil
+}
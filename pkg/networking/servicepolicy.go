@@ -0,0 +1,279 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+// podNodes returns the node each of the named pods runs on.
+func podNodes(ctx context.Context, env *check.Env, namespace string, names []string) (map[string]string, error) {
+	nodes := map[string]string{}
+	for _, name := range names {
+		pod, err := env.Clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pod %s: %w", name, err)
+		}
+		nodes[name] = pod.Spec.NodeName
+	}
+	return nodes, nil
+}
+
+// backendsOn returns the backends of f that run on node.
+func backendsOn(f *serviceFixture, nodes map[string]string, node string) []string {
+	var local []string
+	for _, name := range f.backends {
+		if nodes[name] == node {
+			local = append(local, name)
+		}
+	}
+	return local
+}
+
+// repeat returns count copies of url.
+func repeat(url string, count int) []string {
+	urls := make([]string, count)
+	for i := range urls {
+		urls[i] = url
+	}
+	return urls
+}
+
+// TestServiceHairpin has a backend pod send requests through its own
+// service's ClusterIP. The requests that are routed back to the sender need
+// hairpin NAT on the node; they fail when the CNI or kubelet hairpin mode is
+// off while requests to the other backends still work.
+func TestServiceHairpin(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	f, cleanup, err := startServiceFixture(ctx, env, namespace, nil)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	// The backend busybox image has wget, so it can be the client.
+	self := f.backends[0]
+	url := httpURL(f.service.Spec.ClusterIP, 80)
+	hits, err := requestSpread(ctx, env, namespace, self, url, len(f.backends)*requestsPerBackend, f.backends)
+	if err != nil {
+		return fmt.Errorf("backend %s through its own service %s: %w; hairpin NAT may be disabled", self, url, err)
+	}
+	env.Notef("backend %s reached itself through ClusterIP %s: %s", self, f.service.Spec.ClusterIP, hits)
+	return nil
+}
+
+// TestServiceSessionAffinity sends requests from one client pod through a
+// service with sessionAffinity ClientIP and fails unless a single backend
+// answers all of them.
+func TestServiceSessionAffinity(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	f, cleanup, err := startServiceFixture(ctx, env, namespace, func(spec *corev1.ServiceSpec) {
+		spec.SessionAffinity = corev1.ServiceAffinityClientIP
+	})
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	count := len(f.backends) * requestsPerBackend
+	results, err := probeHTTPAll(ctx, env, namespace, f.client, repeat(httpURL(f.service.Spec.ClusterIP, 80), count))
+	if err != nil {
+		return err
+	}
+	hits := map[string]int{}
+	for _, result := range results {
+		if result.Err != nil {
+			return fmt.Errorf("request through service %s failed: %w", f.service.Name, result.Err)
+		}
+		hits[result.Body]++
+	}
+	if len(hits) != 1 {
+		return fmt.Errorf("sessionAffinity ClientIP not honoured: %d requests from one pod were answered by %s",
+			count, describeHits(hits))
+	}
+	for backend := range hits {
+		env.Notef("%d requests from pod %s all answered by %s", count, f.client, backend)
+	}
+	return nil
+}
+
+// TestServiceInternalTrafficPolicy sends requests through a service with
+// internalTrafficPolicy Local. Only backends on the client pod's node may
+// answer, and when there are none the requests must be dropped.
+func TestServiceInternalTrafficPolicy(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	local := corev1.ServiceInternalTrafficPolicyLocal
+	f, cleanup, err := startServiceFixture(ctx, env, namespace, func(spec *corev1.ServiceSpec) {
+		spec.InternalTrafficPolicy = &local
+	})
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	nodes, err := podNodes(ctx, env, namespace, append(slices.Clone(f.backends), f.client))
+	if err != nil {
+		return err
+	}
+	node := nodes[f.client]
+	localBackends := backendsOn(f, nodes, node)
+
+	// Requests that should be dropped each wait for the probe timeout, so
+	// fewer are sent.
+	count := 2
+	if len(localBackends) > 0 {
+		count = len(localBackends) * requestsPerBackend
+	}
+	results, err := probeHTTPAll(ctx, env, namespace, f.client, repeat(httpURL(f.service.Spec.ClusterIP, 80), count))
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		switch {
+		case result.Err == nil && !slices.Contains(localBackends, result.Body):
+			return fmt.Errorf("request from node %s was answered by backend %s on node %s, but internalTrafficPolicy is Local",
+				node, result.Body, nodes[result.Body])
+		case result.Err != nil && len(localBackends) > 0:
+			return fmt.Errorf("request from node %s with local backends %s failed: %w",
+				node, strings.Join(localBackends, ", "), result.Err)
+		}
+	}
+	if len(localBackends) == 0 {
+		env.Notef("no backend on client node %s, requests were dropped", node)
+	} else {
+		env.Notef("%d requests from node %s answered only by local backends %s", count, node, strings.Join(localBackends, ", "))
+	}
+	return nil
+}
+
+// TestServiceExternalTrafficPolicy requests the node port of a service with
+// externalTrafficPolicy Local on every node from a hostNetwork pod. Traffic
+// from the pod network counts as internal to kube-proxy, which routes it to
+// any backend, so the requests must come from a node address. The client's
+// own node is left out, since traffic from a node to itself is internal too.
+// Nodes must only forward to their own backends and drop requests when they
+// have none.
+func TestServiceExternalTrafficPolicy(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	f, cleanup, err := startServiceFixture(ctx, env, namespace, func(spec *corev1.ServiceSpec) {
+		spec.Type = corev1.ServiceTypeNodePort
+		spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyLocal
+	})
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	nodePort := int(f.service.Spec.Ports[0].NodePort)
+	if nodePort == 0 {
+		return fmt.Errorf("service %s was not assigned a node port", f.service.Name)
+	}
+
+	client := newClientPod(env, namespace, env.Name("etp-client"), nil)
+	client.Spec.HostNetwork = true
+	deleteClient, err := createPods(ctx, env, client)
+	defer deleteClient()
+	if err != nil {
+		return err
+	}
+	if _, err := waitForPodRunning(ctx, env, namespace, client.Name); err != nil {
+		return err
+	}
+	podNode, err := podNodes(ctx, env, namespace, append(slices.Clone(f.backends), client.Name))
+	if err != nil {
+		return err
+	}
+	clientNode := podNode[client.Name]
+
+	nodes, err := env.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	// Each node gets requestsPerBackend requests if it has local backends,
+	// else one that should be dropped.
+	var urls, targets []string
+	local := map[string][]string{}
+	for _, node := range nodes.Items {
+		ip := nodeAddress(&node, corev1.NodeInternalIP)
+		if ip == "" || node.Name == clientNode {
+			continue
+		}
+		local[node.Name] = backendsOn(f, podNode, node.Name)
+		count := 1
+		if len(local[node.Name]) > 0 {
+			count = requestsPerBackend
+		}
+		for _, url := range repeat(httpURL(ip, nodePort), count) {
+			urls = append(urls, url)
+			targets = append(targets, node.Name)
+		}
+	}
+	if len(urls) == 0 {
+		return check.Skip("no node other than the client's node %s has an internal IP", clientNode)
+	}
+
+	results, err := probeHTTPAll(ctx, env, namespace, client.Name, urls)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	for i, result := range results {
+		node := targets[i]
+		switch {
+		case result.Err == nil && !slices.Contains(local[node], result.Body):
+			failures = append(failures, fmt.Sprintf("%s forwarded to backend %s on node %s", node, result.Body, podNode[result.Body]))
+		case result.Err != nil && len(local[node]) > 0:
+			failures = append(failures, fmt.Sprintf("%s with local backends %s: %v", node, strings.Join(local[node], ", "), result.Err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("externalTrafficPolicy Local not honoured on node port %d: %s", nodePort, strings.Join(failures, "; "))
+	}
+
+	var serving, dropping int
+	for _, backends := range local {
+		if len(backends) > 0 {
+			serving++
+		} else {
+			dropping++
+		}
+	}
+	env.Notef("node port %d answered by local backends on %d nodes and dropped on %d nodes without one, requested from node %s",
+		nodePort, serving, dropping, clientNode)
+	return nil
+}
+
+// describeHits lists how many requests each backend answered.
+func describeHits(hits map[string]int) string {
+	names := make([]string, 0, len(hits))
+	for name := range hits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s (%d)", name, hits[name])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,236 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/netperf"
+)
+
+const (
+	// netperfRepository is where CI publishes the image running cmd/netperf
+	// on busybox, tagged with the commit it was built from and latest.
+	netperfRepository = "ghcr.io/denhamparry/ktest-netperf"
+	// throughputDuration is how long each throughput test sends for.
+	throughputDuration = 10 * time.Second
+	// udpBandwidthMbps is the rate UDP tests send at; jitter and loss are
+	// what they measure, not the highest rate.
+	udpBandwidthMbps = 100
+)
+
+// netperfImageTag is the tag of the default netperf image. CI sets it for the
+// builds it publishes an image for with
+// -ldflags "-X github.com/denhamparry/kubernetes-testing/pkg/networking.netperfImageTag=<commit>",
+// so that the image matches the netperf package parsing its output. Other
+// builds use latest, since their commit may never have been published.
+var netperfImageTag string
+
+// defaultNetperfImage is the netperf image checks run when none is
+// configured.
+var defaultNetperfImage = netperfRepository + ":" + netperfTag()
+
+// netperfTag returns netperfImageTag, or latest when it is not set.
+func netperfTag() string {
+	if netperfImageTag != "" {
+		return netperfImageTag
+	}
+	return "latest"
+}
+
+// throughputPath is a client pod measuring throughput to the server.
+type throughputPath struct {
+	name string
+	pod  *corev1.Pod
+}
+
+// schedulableNodes returns the ready nodes that accept pods without
+// tolerations.
+func schedulableNodes(ctx context.Context, env *check.Env) ([]corev1.Node, error) {
+	nodes, err := env.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var schedulable []corev1.Node
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable || !nodeReady(&node) {
+			continue
+		}
+		tainted := false
+		for _, taint := range node.Spec.Taints {
+			if taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute {
+				tainted = true
+			}
+		}
+		if !tainted {
+			schedulable = append(schedulable, node)
+		}
+	}
+	return schedulable, nil
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// onNode returns a node selector pinning a pod to node.
+func onNode(node *corev1.Node) map[string]string {
+	hostname := node.Labels[corev1.LabelHostname]
+	if hostname == "" {
+		hostname = node.Name
+	}
+	return map[string]string{corev1.LabelHostname: hostname}
+}
+
+// netperfPod returns a pod running the netperf image with args, or idling
+// so that the client can be run in it when args is empty.
+func netperfPod(env *check.Env, namespace, name, image string, args ...string) *corev1.Pod {
+	container := corev1.Container{
+		Name:    "netperf",
+		Image:   image,
+		Command: []string{"sleep", "3600"},
+	}
+	if len(args) > 0 {
+		port := intstr.FromInt(netperf.DefaultPort)
+		container.Command = append([]string{"netperf"}, args...)
+		container.Ports = []corev1.ContainerPort{
+			{ContainerPort: int32(netperf.DefaultPort), Protocol: corev1.ProtocolTCP},
+			{ContainerPort: int32(netperf.DefaultPort), Protocol: corev1.ProtocolUDP},
+		}
+		container.ReadinessProbe = &corev1.Probe{
+			ProbeHandler:  corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: port}},
+			PeriodSeconds: 2,
+		}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    env.Labels(nil),
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{container}},
+	}
+}
+
+// TestPodThroughput measures TCP throughput and UDP jitter and loss from a
+// client pod on the server's node and from one on another node, using the
+// netperf image. TCP throughput below the minThroughput threshold or UDP loss
+// above the errorRate threshold fails the check.
+func TestPodThroughput(ctx context.Context, env *check.Env) error {
+	namespace := env.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	image := env.Settings.Image
+	if image == "" {
+		image = defaultNetperfImage
+	}
+
+	nodes, err := schedulableNodes(ctx, env)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no ready node accepts pods")
+	}
+
+	server := netperfPod(env, namespace, env.Name("netperf-server"), image, "server")
+	server.Spec.NodeSelector = onNode(&nodes[0])
+	paths := []throughputPath{{name: "same-node", pod: netperfPod(env, namespace, env.Name("netperf-client"), image)}}
+	paths[0].pod.Spec.NodeSelector = onNode(&nodes[0])
+	if len(nodes) > 1 {
+		cross := netperfPod(env, namespace, env.Name("netperf-client"), image)
+		cross.Spec.NodeSelector = onNode(&nodes[1])
+		paths = append(paths, throughputPath{name: "cross-node", pod: cross})
+	} else {
+		env.Notef("only node %s accepts pods, cross-node throughput not measured", nodes[0].Name)
+	}
+
+	pods := []*corev1.Pod{server}
+	for _, path := range paths {
+		pods = append(pods, path.pod)
+	}
+	deletePods, err := createPods(ctx, env, pods...)
+	defer deletePods()
+	if err != nil {
+		return err
+	}
+	running, err := waitForPodRunning(ctx, env, namespace, server.Name)
+	if err != nil {
+		return err
+	}
+	serverIP := running.Status.PodIP
+	for _, path := range paths {
+		if _, err := waitForPodRunning(ctx, env, namespace, path.pod.Name); err != nil {
+			return err
+		}
+	}
+
+	thresholds := env.Settings.Thresholds
+	var summary, failures []string
+	env.Detailf("%-12s %-8s %14s %12s %10s %8s", "PATH", "PROTOCOL", "THROUGHPUT", "RETRANSMITS", "JITTER", "LOSS")
+	// Tests run one at a time so that they do not compete for bandwidth.
+	for _, path := range paths {
+		for _, protocol := range []string{netperf.TCP, netperf.UDP} {
+			result, err := runNetperf(ctx, env, namespace, path.pod.Name, serverIP, protocol)
+			if err != nil {
+				return fmt.Errorf("%s %s test: %w", path.name, protocol, err)
+			}
+			label := path.name + " " + protocol
+			switch protocol {
+			case netperf.TCP:
+				retransmits := "-"
+				if result.Retransmits >= 0 {
+					retransmits = strconv.FormatInt(result.Retransmits, 10)
+				}
+				env.Detailf("%-12s %-8s %9.2f Gb/s %12s %10s %8s", path.name, protocol, result.Gbps(), retransmits, "-", "-")
+				summary = append(summary, fmt.Sprintf("%s %.2f Gbit/s", label, result.Gbps()))
+				if thresholds.MinThroughput > 0 && result.Gbps() < thresholds.MinThroughput {
+					failures = append(failures, fmt.Sprintf("%s %.2f Gbit/s < %.2f Gbit/s", label, result.Gbps(), thresholds.MinThroughput))
+				}
+			case netperf.UDP:
+				jitter := result.Jitter.Round(time.Microsecond)
+				env.Detailf("%-12s %-8s %9.2f Gb/s %12s %10s %7.2f%%", path.name, protocol, result.Gbps(), "-", jitter, result.LossPercent())
+				summary = append(summary, fmt.Sprintf("%s jitter %s, %.2f%% loss", label, jitter, result.LossPercent()))
+				if thresholds.ErrorRate > 0 && result.LossPercent() > thresholds.ErrorRate {
+					failures = append(failures, fmt.Sprintf("%s loss %.2f%% > %.2f%%", label, result.LossPercent(), thresholds.ErrorRate))
+				}
+			}
+		}
+	}
+	env.Notef("%s", strings.Join(summary, ", "))
+
+	if len(failures) > 0 {
+		return fmt.Errorf("throughput thresholds not met: %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// runNetperf runs one netperf client test in the pod against serverIP.
+func runNetperf(ctx context.Context, env *check.Env, namespace, pod, serverIP, protocol string) (*netperf.Result, error) {
+	stdout, stderr, err := env.Exec(ctx, namespace, pod, "netperf", "client", serverIP,
+		"--protocol", protocol,
+		"--duration", throughputDuration.String(),
+		"--bandwidth", strconv.Itoa(udpBandwidthMbps))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exec in pod %s: %w (%s)", pod, err, strings.TrimSpace(stderr))
+	}
+	var result netperf.Result
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		return nil, fmt.Errorf("unexpected netperf output in pod %s: %q", pod, stdout)
+	}
+	return &result, nil
+}
@@ -77,15 +77,25 @@ func (l *LoadTest) Run(ctx context.Context) (*Metrics, error) {
 }
 
 func (l *LoadTest) calculateMetrics(startTime time.Time, total, success, failed int, latencies []time.Duration) *Metrics {
-	duration := time.Since(startTime)
-	avgLatency, p95, p99 := calculateLatencyPercentiles(latencies)
+	return NewMetrics(time.Since(startTime), total, success, failed, latencies)
+}
+
+// NewMetrics summarizes total operations over duration, of which success
+// succeeded and failed failed, with the latency of each. It sorts latencies.
+func NewMetrics(duration time.Duration, total, success, failed int, latencies []time.Duration) *Metrics {
+	avgLatency, p50, p95, p99 := calculateLatencyPercentiles(latencies)
 
+	var errorRate float64
+	if total > 0 {
+		errorRate = float64(failed) / float64(total) * 100
+	}
 	return &Metrics{
 		AverageLatency: avgLatency,
+		P50Latency:     p50,
 		P95Latency:     p95,
 		P99Latency:     p99,
 		Throughput:     float64(total) / duration.Seconds(),
-		ErrorRate:      float64(failed) / float64(total) * 100,
+		ErrorRate:      errorRate,
 		TotalRequests:  total,
 		SuccessCount:   success,
 		FailureCount:   failed,
@@ -93,9 +103,9 @@ func (l *LoadTest) calculateMetrics(startTime time.Time, total, success, failed
 	}
 }
 
-func calculateLatencyPercentiles(latencies []time.Duration) (avg, p95, p99 time.Duration) {
+func calculateLatencyPercentiles(latencies []time.Duration) (avg, p50, p95, p99 time.Duration) {
 	if len(latencies) == 0 {
-		return 0, 0, 0
+		return 0, 0, 0, 0
 	}
 
 	// Sort latencies for correct percentile calculation
@@ -111,18 +121,13 @@ func calculateLatencyPercentiles(latencies []time.Duration) (avg, p95, p99 time.
 	avg = sum / time.Duration(len(latencies))
 
 	// Calculate percentiles from sorted array
-	p95Index := int(float64(len(latencies)) * 0.95)
-	p99Index := int(float64(len(latencies)) * 0.99)
-
-	if p95Index >= len(latencies) {
-		p95Index = len(latencies) - 1
-	}
-	if p99Index >= len(latencies) {
-		p99Index = len(latencies) - 1
+	percentile := func(p float64) time.Duration {
+		index := int(float64(len(latencies)) * p)
+		if index >= len(latencies) {
+			index = len(latencies) - 1
+		}
+		return latencies[index]
 	}
 
-	p95 = latencies[p95Index]
-	p99 = latencies[p99Index]
-
-	return avg, p95, p99
+	return avg, percentile(0.50), percentile(0.95), percentile(0.99)
 }
@@ -7,6 +7,7 @@ import (
 
 type Metrics struct {
 	AverageLatency time.Duration
+	P50Latency     time.Duration
 	P95Latency     time.Duration
 	P99Latency     time.Duration
 	Throughput     float64
@@ -29,6 +30,7 @@ Error Rate:       %.2f%%
 
 Latency Metrics:
   Average:        %s
+  P50:            %s
   P95:            %s
   P99:            %s
 
@@ -40,6 +42,7 @@ Throughput:       %.2f req/s
 		m.FailureCount,
 		m.ErrorRate,
 		m.AverageLatency,
+		m.P50Latency,
 		m.P95Latency,
 		m.P99Latency,
 		m.Throughput,
@@ -47,3 +50,29 @@ Throughput:       %.2f req/s
 
 	return report
 }
+
+// Thresholds are limits on Metrics. Zero values are not checked.
+type Thresholds struct {
+	P95Latency time.Duration
+	P99Latency time.Duration
+	// ErrorRate is the highest acceptable error rate in percent.
+	ErrorRate float64
+	// MinThroughput is the lowest acceptable throughput in Gbit/s. Metrics
+	// do not measure it; throughput benchmarks check it themselves.
+	MinThroughput float64
+}
+
+// Exceeded returns a description of every threshold the metrics exceed.
+func (m *Metrics) Exceeded(t Thresholds) []string {
+	var exceeded []string
+	if t.P95Latency > 0 && m.P95Latency > t.P95Latency {
+		exceeded = append(exceeded, fmt.Sprintf("p95 latency %s > %s", m.P95Latency, t.P95Latency))
+	}
+	if t.P99Latency > 0 && m.P99Latency > t.P99Latency {
+		exceeded = append(exceeded, fmt.Sprintf("p99 latency %s > %s", m.P99Latency, t.P99Latency))
+	}
+	if t.ErrorRate > 0 && m.ErrorRate > t.ErrorRate {
+		exceeded = append(exceeded, fmt.Sprintf("error rate %.2f%% > %.2f%%", m.ErrorRate, t.ErrorRate))
+	}
+	return exceeded
+}
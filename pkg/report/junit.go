@@ -0,0 +1,116 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// GenerateJUnit renders the report as JUnit XML. Results are grouped into
+// one testsuite per category, falling back to the report's TestSuite name
+// for results without a category.
+func (r *TestReport) GenerateJUnit() (string, error) {
+	suites := junitTestSuites{
+		Name: r.TestSuite,
+		Time: junitSeconds(r.EndTime.Sub(r.StartTime)),
+	}
+
+	index := map[string]int{}
+	var durations []time.Duration
+	for _, result := range r.Results {
+		suiteName := result.Category
+		if suiteName == "" {
+			suiteName = r.TestSuite
+		}
+
+		i, ok := index[suiteName]
+		if !ok {
+			i = len(suites.Suites)
+			index[suiteName] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: suiteName})
+			durations = append(durations, 0)
+			if !r.StartTime.IsZero() {
+				suites.Suites[i].Timestamp = r.StartTime.UTC().Format(time.RFC3339)
+			}
+		}
+		suite := &suites.Suites[i]
+
+		testCase := junitTestCase{
+			Name:      result.Name,
+			ClassName: r.TestSuite + "." + suiteName,
+			Time:      junitSeconds(result.Duration),
+			SystemOut: result.Details,
+		}
+		switch result.Status {
+		case "failed":
+			testCase.Failure = &junitMessage{Message: result.Message, Body: result.Message}
+			suite.Failures++
+			suites.Failures++
+		case "skipped":
+			testCase.Skipped = &junitMessage{Message: result.Message}
+			suite.Skipped++
+			suites.Skipped++
+		case "interrupted":
+			// An interrupted test did not get to pass or fail, which JUnit
+			// reports as an error.
+			testCase.Error = &junitMessage{Message: "interrupted", Body: result.Message}
+			suite.Errors++
+			suites.Errors++
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+		suites.Tests++
+		durations[i] += result.Duration
+	}
+	for i := range suites.Suites {
+		suites.Suites[i].Time = junitSeconds(durations[i])
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal report to JUnit XML: %w", err)
+	}
+	return xml.Header + string(data) + "\n", nil
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
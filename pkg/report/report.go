@@ -3,10 +3,14 @@ package report
 import (
 	"encoding/json"
 	"fmt"
+	"html"
 	"strings"
 	"time"
 )
 
+// Formats lists the output formats supported by Render.
+var Formats = []string{"text", "json", "html", "junit"}
+
 type TestReport struct {
 	TestSuite  string
 	StartTime  time.Time
@@ -15,14 +19,19 @@ type TestReport struct {
 	Passed     int
 	Failed     int
 	Skipped    int
-	Results    []TestResult
+	// Interrupted counts tests stopped by a signal before they finished.
+	Interrupted int
+	Results     []TestResult
 }
 
 type TestResult struct {
 	Name     string
+	Category string
 	Status   string
 	Duration time.Duration
 	Message  string
+	// Details is optional multi-line output such as a connectivity matrix.
+	Details string
 }
 
 func NewTestReport(testSuite string) *TestReport {
@@ -44,6 +53,8 @@ func (r *TestReport) AddResult(result TestResult) {
 		r.Failed++
 	case "skipped":
 		r.Skipped++
+	case "interrupted":
+		r.Interrupted++
 	}
 }
 
@@ -54,7 +65,7 @@ func (r *TestReport) Complete() {
 func (r *TestReport) GenerateHTML() (string, error) {
 	duration := r.EndTime.Sub(r.StartTime)
 
-	html := fmt.Sprintf(`
+	out := fmt.Sprintf(`
 <!DOCTYPE html>
 <html>
 <head>
@@ -65,6 +76,7 @@ func (r *TestReport) GenerateHTML() (string, error) {
         .passed { color: green; }
         .failed { color: red; }
         .skipped { color: orange; }
+        .interrupted { color: purple; }
         table { width: 100%%; border-collapse: collapse; margin-top: 20px; }
         th, td { padding: 10px; text-align: left; border-bottom: 1px solid #ddd; }
         th { background-color: #4CAF50; color: white; }
@@ -78,6 +90,7 @@ func (r *TestReport) GenerateHTML() (string, error) {
         <p class="passed"><strong>Passed:</strong> %d</p>
         <p class="failed"><strong>Failed:</strong> %d</p>
         <p class="skipped"><strong>Skipped:</strong> %d</p>
+        <p class="interrupted"><strong>Interrupted:</strong> %d</p>
     </div>
     <table>
         <thead>
@@ -90,11 +103,15 @@ func (r *TestReport) GenerateHTML() (string, error) {
         </thead>
         <tbody>
 `,
-		r.TestSuite, r.TestSuite, duration, r.TotalTests, r.Passed, r.Failed, r.Skipped)
+		html.EscapeString(r.TestSuite), html.EscapeString(r.TestSuite), duration, r.TotalTests, r.Passed, r.Failed, r.Skipped, r.Interrupted)
 
 	for _, result := range r.Results {
-		statusClass := result.Status
-		html += fmt.Sprintf(`
+		statusClass := html.EscapeString(result.Status)
+		message := html.EscapeString(result.Message)
+		if result.Details != "" {
+			message += "<pre>" + html.EscapeString(result.Details) + "</pre>"
+		}
+		out += fmt.Sprintf(`
             <tr>
                 <td>%s</td>
                 <td class="%s">%s</td>
@@ -102,17 +119,17 @@ func (r *TestReport) GenerateHTML() (string, error) {
                 <td>%s</td>
             </tr>
 `,
-			result.Name, statusClass, strings.ToUpper(result.Status), result.Duration, result.Message)
+			html.EscapeString(result.Name), statusClass, strings.ToUpper(statusClass), result.Duration, message)
 	}
 
-	html += `
+	out += `
         </tbody>
     </table>
 </body>
 </html>
 `
 
-	return html, nil
+	return out, nil
 }
 
 func (r *TestReport) GenerateJSON() (string, error) {
@@ -123,18 +140,23 @@ func (r *TestReport) GenerateJSON() (string, error) {
 	return string(data), nil
 }
 
-func (r *TestReport) Print() {
+// GenerateText renders the report in the same layout Print writes to stdout.
+func (r *TestReport) GenerateText() (string, error) {
 	duration := r.EndTime.Sub(r.StartTime)
 
-	fmt.Println("\n" + strings.Repeat("=", 60))
-	fmt.Printf("%s Test Report\n", r.TestSuite)
-	fmt.Println(strings.Repeat("=", 60))
-	fmt.Printf("Duration:     %s\n", duration)
-	fmt.Printf("Total Tests:  %d\n", r.TotalTests)
-	fmt.Printf("Passed:       %d\n", r.Passed)
-	fmt.Printf("Failed:       %d\n", r.Failed)
-	fmt.Printf("Skipped:      %d\n", r.Skipped)
-	fmt.Println(strings.Repeat("-", 60))
+	var b strings.Builder
+	fmt.Fprintln(&b, "\n"+strings.Repeat("=", 60))
+	fmt.Fprintf(&b, "%s Test Report\n", r.TestSuite)
+	fmt.Fprintln(&b, strings.Repeat("=", 60))
+	fmt.Fprintf(&b, "Duration:     %s\n", duration)
+	fmt.Fprintf(&b, "Total Tests:  %d\n", r.TotalTests)
+	fmt.Fprintf(&b, "Passed:       %d\n", r.Passed)
+	fmt.Fprintf(&b, "Failed:       %d\n", r.Failed)
+	fmt.Fprintf(&b, "Skipped:      %d\n", r.Skipped)
+	if r.Interrupted > 0 {
+		fmt.Fprintf(&b, "Interrupted:  %d\n", r.Interrupted)
+	}
+	fmt.Fprintln(&b, strings.Repeat("-", 60))
 
 	for _, result := range r.Results {
 		statusSymbol := "✓"
@@ -142,13 +164,49 @@ func (r *TestReport) Print() {
 			statusSymbol = "✗"
 		} else if result.Status == "skipped" {
 			statusSymbol = "⊘"
+		} else if result.Status == "interrupted" {
+			statusSymbol = "!"
 		}
 
-		fmt.Printf("%s %s (%s)\n", statusSymbol, result.Name, result.Duration)
+		fmt.Fprintf(&b, "%s %s (%s)\n", statusSymbol, result.Name, result.Duration)
 		if result.Message != "" {
-			fmt.Printf("  %s\n", result.Message)
+			fmt.Fprintf(&b, "  %s\n", result.Message)
 		}
+		for _, line := range DetailLines(result.Details) {
+			fmt.Fprintf(&b, "    %s\n", line)
+		}
+	}
+
+	fmt.Fprintln(&b, strings.Repeat("=", 60))
+	return b.String(), nil
+}
+
+// DetailLines splits a result's details into lines, dropping the trailing
+// newline.
+func DetailLines(details string) []string {
+	if details == "" {
+		return nil
 	}
+	return strings.Split(strings.TrimRight(details, "\n"), "\n")
+}
 
-	fmt.Println(strings.Repeat("=", 60))
+func (r *TestReport) Print() {
+	text, _ := r.GenerateText()
+	fmt.Print(text)
+}
+
+// Render generates the report in the named format (see Formats).
+func (r *TestReport) Render(format string) (string, error) {
+	switch format {
+	case "text":
+		return r.GenerateText()
+	case "json":
+		return r.GenerateJSON()
+	case "html":
+		return r.GenerateHTML()
+	case "junit":
+		return r.GenerateJUnit()
+	default:
+		return "", fmt.Errorf("unsupported report format: %s (must be one of %s)", format, strings.Join(Formats, ", "))
+	}
 }
@@ -0,0 +1,14 @@
+package storage
+
+import (
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const category = "storage"
+
+func init() {
+	check.Register(check.New("storage-class", category,
+		"Verify a default storage class exists", TestStorageClass))
+	check.Register(check.New("pvc-creation", category,
+		"Create a PVC and wait for it to bind", TestPVCCreation))
+}
@@ -10,12 +10,28 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
 )
 
-func TestPVCCreation(ctx context.Context, clientset kubernetes.Interface, namespace, storageClass string) error {
+// defaultPVCSize is the requested capacity when no size is configured.
+const defaultPVCSize = "1Gi"
+
+func TestPVCCreation(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
 	if namespace == "" {
 		namespace = "default"
 	}
+	size := env.Settings.Size
+	if size == "" {
+		size = defaultPVCSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return fmt.Errorf("invalid PVC size %q: %w", size, err)
+	}
+	storageClass := env.Settings.StorageClass
 	if storageClass == "" {
 		// Auto-detect default storage class instead of hardcoding "standard"
 		defaultSC, err := getDefaultStorageClass(ctx, clientset)
@@ -25,14 +41,14 @@ func TestPVCCreation(ctx context.Context, clientset kubernetes.Interface, namesp
 		storageClass = defaultSC
 	}
 
-	timestamp := time.Now().Unix()
-	pvcName := fmt.Sprintf("test-pvc-%d", timestamp)
+	pvcName := env.Name("test-pvc")
 
 	// Create PVC
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      pvcName,
 			Namespace: namespace,
+			Labels:    env.Labels(nil),
 		},
 		Spec: corev1.PersistentVolumeClaimSpec{
 			AccessModes: []corev1.PersistentVolumeAccessMode{
@@ -40,29 +56,25 @@ func TestPVCCreation(ctx context.Context, clientset kubernetes.Interface, namesp
 			},
 			Resources: corev1.VolumeResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse("1Gi"),
+					corev1.ResourceStorage: quantity,
 				},
 			},
 			StorageClassName: &storageClass,
 		},
 	}
 
-	_, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{})
+	_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create PVC: %w", err)
 	}
 
 	// Clean up PVC
-	defer func() {
-		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(deleteCtx, pvcName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Warning: failed to cleanup PVC %s: %v\n", pvcName, err)
-		}
-	}()
+	defer env.Cleanup("PVC", pvcName, func(ctx context.Context) error {
+		return clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, pvcName, metav1.DeleteOptions{})
+	})
 
 	// Wait for PVC to be bound using proper wait mechanism
-	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, 60*time.Second, true,
+	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, env.Timeout(), true,
 		func(ctx context.Context) (bool, error) {
 			pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
 			if err != nil {
@@ -83,9 +95,9 @@ func TestPVCCreation(ctx context.Context, clientset kubernetes.Interface, namesp
 	return nil
 }
 
-func TestStorageClass(ctx context.Context, clientset kubernetes.Interface) error {
+func TestStorageClass(ctx context.Context, env *check.Env) error {
 	// List available storage classes
-	storageClasses, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	storageClasses, err := env.Clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to list storage classes: %w", err)
 	}
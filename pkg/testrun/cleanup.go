@@ -0,0 +1,295 @@
+package testrun
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Resource is an object created by ktest that is still in the cluster.
+type Resource struct {
+	Kind      string
+	Namespace string
+	Name      string
+	RunID     string
+	Created   time.Time
+}
+
+func (r Resource) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s %s", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
+
+// Filter selects which leaked resources to return.
+type Filter struct {
+	// RunID restricts the search to a single run.
+	RunID string
+	// OlderThan only returns resources created more than this long ago.
+	OlderThan time.Duration
+	// Namespace restricts the search to one namespace; empty means all.
+	Namespace string
+}
+
+func (f Filter) selector() string {
+	set := labels.Set{LabelManagedBy: ManagedByValue}
+	if f.RunID != "" {
+		set[LabelRunID] = f.RunID
+	}
+	return labels.SelectorFromSet(set).String()
+}
+
+var background = metav1.DeletePropagationBackground
+
+// kind describes how to list and delete one type of object ktest creates.
+type kind struct {
+	name       string
+	namespaced bool
+	list       func(ctx context.Context, cs kubernetes.Interface, dc dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error)
+	delete     func(ctx context.Context, cs kubernetes.Interface, dc dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error
+}
+
+// httpRouteResource is the Gateway API HTTPRoute, which is only served when
+// its CRD is installed.
+var httpRouteResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+
+// kinds lists every type of object a check may create. Namespaces come first
+// so that objects inside a namespace that is being deleted are not listed
+// separately.
+var kinds = []kind{
+	{
+		name: "namespace",
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, _ string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.CoreV1().Namespaces().List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, _, name string, opts metav1.DeleteOptions) error {
+			return cs.CoreV1().Namespaces().Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "deployment",
+		namespaced: true,
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.AppsV1().Deployments(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return cs.AppsV1().Deployments(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "statefulset",
+		namespaced: true,
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.AppsV1().StatefulSets(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return cs.AppsV1().StatefulSets(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "daemonset",
+		namespaced: true,
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.AppsV1().DaemonSets(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return cs.AppsV1().DaemonSets(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "networkpolicy",
+		namespaced: true,
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.NetworkingV1().NetworkPolicies(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return cs.NetworkingV1().NetworkPolicies(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "ingress",
+		namespaced: true,
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.NetworkingV1().Ingresses(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return cs.NetworkingV1().Ingresses(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "httproute",
+		namespaced: true,
+		list: func(ctx context.Context, _ kubernetes.Interface, dc dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			if dc == nil {
+				return nil, nil
+			}
+			list, err := dc.Resource(httpRouteResource).Namespace(namespace).List(ctx, opts)
+			if apierrors.IsNotFound(err) {
+				// The Gateway API CRDs are not installed.
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, _ kubernetes.Interface, dc dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return dc.Resource(httpRouteResource).Namespace(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "pod",
+		namespaced: true,
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.CoreV1().Pods(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return cs.CoreV1().Pods(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "service",
+		namespaced: true,
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.CoreV1().Services(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return cs.CoreV1().Services(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name:       "PVC",
+		namespaced: true,
+		list: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace string, opts metav1.ListOptions) ([]metav1.Object, error) {
+			list, err := cs.CoreV1().PersistentVolumeClaims(namespace).List(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			return toObjects(list.Items), nil
+		},
+		delete: func(ctx context.Context, cs kubernetes.Interface, _ dynamic.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return cs.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, opts)
+		},
+	},
+}
+
+// toObjects converts a typed list's items into their object metadata.
+func toObjects[T any, PT interface {
+	*T
+	metav1.Object
+}](items []T) []metav1.Object {
+	objects := make([]metav1.Object, 0, len(items))
+	for i := range items {
+		objects = append(objects, PT(&items[i]))
+	}
+	return objects
+}
+
+func findKind(name string) (kind, bool) {
+	for _, k := range kinds {
+		if k.name == name {
+			return k, true
+		}
+	}
+	return kind{}, false
+}
+
+// FindLeaked lists objects created by ktest that match filter. The dynamic
+// client finds custom resources such as HTTPRoutes; they are not searched
+// when it is nil. Objects owned by another object (e.g. pods of a
+// deployment) and objects inside a ktest namespace that is itself returned
+// are left out, since deleting their owner removes them.
+func FindLeaked(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, filter Filter) ([]Resource, error) {
+	opts := metav1.ListOptions{LabelSelector: filter.selector()}
+	now := time.Now()
+
+	var resources []Resource
+	namespaces := map[string]bool{}
+	for _, k := range kinds {
+		if !k.namespaced && filter.Namespace != "" {
+			continue
+		}
+
+		objects, err := k.list(ctx, clientset, dynamicClient, filter.Namespace, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %ss: %w", k.name, err)
+		}
+
+		for _, obj := range objects {
+			if len(obj.GetOwnerReferences()) > 0 || namespaces[obj.GetNamespace()] {
+				continue
+			}
+			created := obj.GetCreationTimestamp().Time
+			if filter.OlderThan > 0 && now.Sub(created) < filter.OlderThan {
+				continue
+			}
+			if !k.namespaced {
+				namespaces[obj.GetName()] = true
+			}
+			resources = append(resources, Resource{
+				Kind:      k.name,
+				Namespace: obj.GetNamespace(),
+				Name:      obj.GetName(),
+				RunID:     obj.GetLabels()[LabelRunID],
+				Created:   created,
+			})
+		}
+	}
+
+	return resources, nil
+}
+
+// Delete removes a resource returned by FindLeaked. Dependents are removed
+// in the background by the garbage collector.
+func Delete(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, r Resource) error {
+	k, ok := findKind(r.Kind)
+	if !ok {
+		return fmt.Errorf("unknown resource kind %s", r.Kind)
+	}
+
+	err := k.delete(ctx, clientset, dynamicClient, r.Namespace, r.Name, metav1.DeleteOptions{PropagationPolicy: &background})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", r, err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package testrun
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LabelManagedBy marks every object created by ktest.
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	// ManagedByValue is the LabelManagedBy value used by ktest.
+	ManagedByValue = "ktest"
+	// LabelRunID records which ktest run created an object.
+	LabelRunID = "ktest.io/run-id"
+
+	namespacePrefix = "ktest-"
+)
+
+// NewID returns a short random identifier for a ktest run. It is safe to use
+// in object names and label values.
+func NewID() string {
+	return utilrand.String(8)
+}
+
+// Labels returns the labels identifying objects created by the given run.
+func Labels(runID string) map[string]string {
+	return map[string]string{
+		LabelManagedBy: ManagedByValue,
+		LabelRunID:     runID,
+	}
+}
+
+// NamespaceName returns the name of the ephemeral namespace for a run.
+func NamespaceName(runID string) string {
+	return namespacePrefix + runID
+}
+
+// CreateNamespace creates the labelled, ephemeral namespace for a run.
+func CreateNamespace(ctx context.Context, clientset kubernetes.Interface, runID string) (*corev1.Namespace, error) {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   NamespaceName(runID),
+			Labels: Labels(runID),
+		},
+	}
+
+	created, err := clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create namespace %s: %w", namespace.Name, err)
+	}
+	return created, nil
+}
+
+// DeleteNamespace deletes a namespace and waits until it has been finalized,
+// i.e. every object in it has been removed.
+func DeleteNamespace(ctx context.Context, clientset kubernetes.Interface, name string, timeout time.Duration) error {
+	err := clientset.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete namespace %s: %w", name, err)
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true,
+		func(ctx context.Context) (bool, error) {
+			_, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return true, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return false, nil
+		})
+	if err != nil {
+		return fmt.Errorf("namespace %s was not finalized: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package workload
+
+import (
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+)
+
+const category = "workload"
+
+func init() {
+	check.Register(check.Critical(check.New("deployment", category,
+		"Create a deployment and wait for all replicas to be ready", TestDeployment)))
+	check.Register(check.New("statefulset", category,
+		"Create a statefulset and wait for all replicas to be ready", TestStatefulSet))
+}
@@ -9,36 +9,41 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/kubernetes"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
 )
 
-func TestDeployment(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+// defaultReplicas is the replica count used when none is configured.
+const defaultReplicas int32 = 2
+
+func TestDeployment(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
 	if namespace == "" {
 		namespace = "default"
 	}
 
-	timestamp := time.Now().Unix()
-	deploymentName := fmt.Sprintf("test-deployment-%d", timestamp)
-	replicas := int32(2)
+	deploymentName := env.Name("test-deployment")
+	replicas := env.Settings.Replicas
+	if replicas == 0 {
+		replicas = defaultReplicas
+	}
 
 	// Create deployment
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      deploymentName,
 			Namespace: namespace,
+			Labels:    env.Labels(nil),
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &replicas,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "test-deployment",
-				},
+				MatchLabels: env.Selector("test-deployment"),
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": "test-deployment",
-					},
+					Labels: env.Labels(env.Selector("test-deployment")),
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
@@ -63,22 +68,18 @@ func TestDeployment(ctx context.Context, clientset kubernetes.Interface, namespa
 	}
 
 	// Clean up deployment
-	defer func() {
-		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := clientset.AppsV1().Deployments(namespace).Delete(deleteCtx, deploymentName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Warning: failed to cleanup deployment %s: %v\n", deploymentName, err)
-		}
-	}()
+	defer env.Cleanup("deployment", deploymentName, func(ctx context.Context) error {
+		return clientset.AppsV1().Deployments(namespace).Delete(ctx, deploymentName, metav1.DeleteOptions{})
+	})
 
 	// Wait for deployment to be ready using proper wait mechanism
-	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, 60*time.Second, true,
+	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, env.Timeout(), true,
 		func(ctx context.Context) (bool, error) {
 			dep, err := clientset.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
 			if err != nil {
 				return false, err
 			}
-			if dep.Status.ReadyReplicas >= 1 {
+			if dep.Status.ReadyReplicas >= replicas {
 				return true, nil
 			}
 			return false, nil
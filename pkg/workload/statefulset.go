@@ -9,37 +9,39 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/kubernetes"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
 )
 
-func TestStatefulSet(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+func TestStatefulSet(ctx context.Context, env *check.Env) error {
+	clientset := env.Clientset
+	namespace := env.Namespace
 	if namespace == "" {
 		namespace = "default"
 	}
 
-	timestamp := time.Now().Unix()
-	statefulSetName := fmt.Sprintf("test-statefulset-%d", timestamp)
-	replicas := int32(2)
+	statefulSetName := env.Name("test-statefulset")
+	replicas := env.Settings.Replicas
+	if replicas == 0 {
+		replicas = defaultReplicas
+	}
 
 	// Create statefulset
 	statefulSet := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      statefulSetName,
 			Namespace: namespace,
+			Labels:    env.Labels(nil),
 		},
 		Spec: appsv1.StatefulSetSpec{
 			Replicas:    &replicas,
-			ServiceName: "test-service",
+			ServiceName: statefulSetName,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "test-statefulset",
-				},
+				MatchLabels: env.Selector("test-statefulset"),
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": "test-statefulset",
-					},
+					Labels: env.Labels(env.Selector("test-statefulset")),
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
@@ -64,22 +66,18 @@ func TestStatefulSet(ctx context.Context, clientset kubernetes.Interface, namesp
 	}
 
 	// Clean up statefulset
-	defer func() {
-		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := clientset.AppsV1().StatefulSets(namespace).Delete(deleteCtx, statefulSetName, metav1.DeleteOptions{}); err != nil {
-			fmt.Printf("Warning: failed to cleanup statefulset %s: %v\n", statefulSetName, err)
-		}
-	}()
+	defer env.Cleanup("statefulset", statefulSetName, func(ctx context.Context) error {
+		return clientset.AppsV1().StatefulSets(namespace).Delete(ctx, statefulSetName, metav1.DeleteOptions{})
+	})
 
 	// Wait for statefulset to be ready using proper wait mechanism
-	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, 60*time.Second, true,
+	err = wait.PollUntilContextTimeout(ctx, 1*time.Second, env.Timeout(), true,
 		func(ctx context.Context) (bool, error) {
 			sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, statefulSetName, metav1.GetOptions{})
 			if err != nil {
 				return false, err
 			}
-			if sts.Status.ReadyReplicas >= 1 {
+			if sts.Status.ReadyReplicas >= replicas {
 				return true, nil
 			}
 			return false, nil
@@ -3,6 +3,16 @@ set -e
 
 KUBECONFIG="${KUBECONFIG:-$HOME/.kube/config}"
 TEST_SUITE="${1:-all}"
+FAIL_ON="${FAIL_ON:-any}"
+
+# ktest exits 0 when checks pass, 1 when checks fail and 2 when tests could
+# not be run. Keep the most severe status across suites.
+status=0
+record() {
+    if [ "$1" -gt "$status" ]; then
+        status=$1
+    fi
+}
 
 echo "========================================="
 echo "Kubernetes Testing Framework"
@@ -20,11 +30,11 @@ fi
 case $TEST_SUITE in
   conformance)
     echo "Running conformance tests..."
-    ./bin/ktest conformance --kubeconfig "$KUBECONFIG"
+    ./bin/ktest conformance --kubeconfig "$KUBECONFIG" || record $?
     ;;
   operational)
     echo "Running operational tests..."
-    ./bin/ktest operational --kubeconfig "$KUBECONFIG"
+    ./bin/ktest operational --fail-on "$FAIL_ON" --kubeconfig "$KUBECONFIG" || record $?
     ;;
   performance)
     if [ -z "$2" ]; then
@@ -33,16 +43,16 @@ case $TEST_SUITE in
         exit 1
     fi
     echo "Running performance tests..."
-    ./bin/ktest performance --endpoint "$2" --kubeconfig "$KUBECONFIG"
+    ./bin/ktest performance --endpoint "$2" --kubeconfig "$KUBECONFIG" || record $?
     ;;
   all)
     echo "Running all test suites..."
     echo ""
     echo "1/2: Conformance tests..."
-    ./bin/ktest conformance --kubeconfig "$KUBECONFIG" || true
+    ./bin/ktest conformance --kubeconfig "$KUBECONFIG" || record $?
     echo ""
     echo "2/2: Operational tests..."
-    ./bin/ktest operational --kubeconfig "$KUBECONFIG" || true
+    ./bin/ktest operational --fail-on "$FAIL_ON" --kubeconfig "$KUBECONFIG" || record $?
     echo ""
     echo "Note: Performance tests require an endpoint and must be run separately:"
     echo "  $0 performance <endpoint>"
@@ -56,5 +66,10 @@ esac
 
 echo ""
 echo "========================================="
-echo "Tests complete!"
+if [ "$status" -eq 0 ]; then
+    echo "Tests complete!"
+else
+    echo "Tests complete with failures (exit code $status)"
+fi
 echo "========================================="
+exit "$status"
@@ -6,6 +6,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
 	"github.com/denhamparry/kubernetes-testing/pkg/kubeconfig"
 	"github.com/denhamparry/kubernetes-testing/pkg/storage"
 	"github.com/stretchr/testify/assert"
@@ -20,14 +21,15 @@ func TestStorageIntegration(t *testing.T) {
 	}
 
 	ctx := context.Background()
+	env := &check.Env{Clientset: client.Clientset, Namespace: "default"}
 
 	t.Run("TestStorageClass", func(t *testing.T) {
-		err := storage.TestStorageClass(ctx, client.Clientset)
+		err := storage.TestStorageClass(ctx, env)
 		assert.NoError(t, err, "Storage class test should pass")
 	})
 
 	t.Run("TestPVCCreation", func(t *testing.T) {
-		err := storage.TestPVCCreation(ctx, client.Clientset, "default", "")
+		err := storage.TestPVCCreation(ctx, env)
 		// PVC creation might fail if no storage provisioner, but should not panic
 		if err != nil {
 			t.Logf("PVC creation test: %v", err)
@@ -0,0 +1,302 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/testrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/denhamparry/kubernetes-testing/pkg/networking"
+	_ "github.com/denhamparry/kubernetes-testing/pkg/storage"
+	_ "github.com/denhamparry/kubernetes-testing/pkg/workload"
+)
+
+func noop(ctx context.Context, env *check.Env) error { return nil }
+
+func checkNames(checks []check.Check) []string {
+	names := make([]string, 0, len(checks))
+	for _, c := range checks {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+func TestCheckRegistry(t *testing.T) {
+	t.Run("Register", func(t *testing.T) {
+		r := check.NewRegistry()
+		require.NoError(t, r.Register(check.New("a", "networking", "first", noop)))
+		assert.Error(t, r.Register(check.New("a", "storage", "duplicate", noop)))
+		assert.Error(t, r.Register(check.New("", "storage", "no name", noop)))
+		assert.Error(t, r.Register(check.New("b", "", "no category", noop)))
+		assert.Equal(t, []string{"a"}, checkNames(r.Checks()))
+	})
+
+	t.Run("Select", func(t *testing.T) {
+		r := check.NewRegistry()
+		require.NoError(t, r.Register(check.New("dns", "networking", "", noop)))
+		require.NoError(t, r.Register(check.New("pvc", "storage", "", noop)))
+		require.NoError(t, r.Register(check.New("custom", "networking", "", noop)))
+
+		assert.Equal(t, []string{"dns", "custom", "pvc"}, checkNames(r.Select([]string{"all"})))
+		assert.Equal(t, []string{"dns", "custom"}, checkNames(r.Select([]string{"networking"})))
+		assert.Equal(t, []string{"custom", "pvc"}, checkNames(r.Select([]string{"pvc", "custom"})))
+		assert.Empty(t, r.Select([]string{"unknown"}))
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		failing := check.New("failing", "custom", "", func(ctx context.Context, env *check.Env) error {
+			return errors.New("boom")
+		})
+		result := check.Run(context.Background(), failing, &check.Env{})
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Equal(t, "boom", result.Message)
+
+		result = check.Run(context.Background(), check.New("ok", "custom", "", noop), &check.Env{})
+		assert.Equal(t, check.StatusPassed, result.Status)
+	})
+
+	t.Run("BuiltinChecks", func(t *testing.T) {
+		names := checkNames(check.DefaultRegistry.Checks())
+		for _, name := range []string{
+			"dns-resolution", "pod-to-pod", "service-connectivity",
+			"storage-class", "pvc-creation", "deployment", "statefulset",
+		} {
+			assert.Contains(t, names, name)
+		}
+	})
+
+	t.Run("Critical", func(t *testing.T) {
+		plain := check.New("plain", "custom", "", noop)
+		assert.False(t, check.IsCritical(plain))
+
+		critical := check.Critical(plain)
+		assert.True(t, check.IsCritical(critical))
+		assert.Equal(t, "plain", critical.Name())
+
+		dns, ok := check.DefaultRegistry.Get("dns-resolution")
+		require.True(t, ok)
+		assert.True(t, check.IsCritical(dns))
+	})
+}
+
+func TestFailurePolicy(t *testing.T) {
+	failed := check.Failed(errors.New("boom"))
+	passed := check.Passed("")
+	skipped := check.Skipped("disabled")
+
+	for _, tc := range []struct {
+		policy   check.FailurePolicy
+		result   check.Result
+		critical bool
+		fails    bool
+	}{
+		{check.FailOnAny, failed, false, true},
+		{check.FailOnAny, failed, true, true},
+		{check.FailOnAny, passed, true, false},
+		{check.FailOnAny, skipped, true, false},
+		{check.FailOnCritical, failed, false, false},
+		{check.FailOnCritical, failed, true, true},
+		{check.FailOnNever, failed, true, false},
+	} {
+		assert.Equal(t, tc.fails, tc.policy.Fails(tc.result, tc.critical),
+			"policy=%s status=%s critical=%v", tc.policy, tc.result.Status, tc.critical)
+	}
+
+	policy, err := check.ParseFailurePolicy("critical")
+	require.NoError(t, err)
+	assert.Equal(t, check.FailOnCritical, policy)
+
+	_, err = check.ParseFailurePolicy("sometimes")
+	assert.Error(t, err)
+}
+
+func TestRunner(t *testing.T) {
+	t.Run("KeepsOrderAndLimit", func(t *testing.T) {
+		var running, maxRunning int32
+		var finished []int
+		runner := check.Runner{Parallel: 3}
+		results := runner.Run(context.Background(), 10,
+			func(ctx context.Context, i int) check.Result {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				// Later checks finish first.
+				time.Sleep(time.Duration(10-i) * time.Millisecond)
+				return check.Passed(fmt.Sprintf("check-%d", i))
+			},
+			func(i int, result check.Result) {
+				finished = append(finished, i)
+			})
+
+		require.Len(t, results, 10)
+		for i, result := range results {
+			assert.Equal(t, fmt.Sprintf("check-%d", i), result.Message)
+		}
+		assert.Len(t, finished, 10)
+		assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(3))
+	})
+
+	t.Run("Sequential", func(t *testing.T) {
+		var finished []int
+		check.Runner{}.Run(context.Background(), 4,
+			func(ctx context.Context, i int) check.Result { return check.Passed("") },
+			func(i int, result check.Result) { finished = append(finished, i) })
+		assert.Equal(t, []int{0, 1, 2, 3}, finished)
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+
+		waiting := check.New("waiting", "custom", "", func(ctx context.Context, env *check.Env) error {
+			cancel(check.ErrInterrupted)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		started := 0
+		results := check.Runner{GracePeriod: time.Second}.Run(ctx, 3,
+			func(ctx context.Context, i int) check.Result {
+				started++
+				return check.Run(ctx, waiting, &check.Env{})
+			}, nil)
+
+		assert.Equal(t, 1, started)
+		for _, result := range results {
+			assert.Equal(t, check.StatusInterrupted, result.Status)
+		}
+		assert.Equal(t, "not started", results[2].Message)
+	})
+
+	t.Run("GracePeriod", func(t *testing.T) {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		release := make(chan struct{})
+		defer close(release)
+
+		results := check.Runner{GracePeriod: 50 * time.Millisecond}.Run(ctx, 1,
+			func(ctx context.Context, i int) check.Result {
+				// Ignores cancellation until released
+				cancel(check.ErrInterrupted)
+				<-release
+				return check.Passed("")
+			}, nil)
+
+		require.Len(t, results, 1)
+		assert.Equal(t, check.StatusInterrupted, results[0].Status)
+		assert.Contains(t, results[0].Message, "still running")
+	})
+
+	t.Run("GracePeriodAfterDeadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		release := make(chan struct{})
+		defer close(release)
+
+		results := check.Runner{GracePeriod: 50 * time.Millisecond}.Run(ctx, 2,
+			func(ctx context.Context, i int) check.Result {
+				<-release
+				return check.Passed("")
+			}, nil)
+
+		require.Len(t, results, 2)
+		for _, result := range results {
+			assert.Equal(t, check.StatusFailed, result.Status)
+		}
+		assert.Equal(t, "still running 50ms after cancellation: context deadline exceeded", results[0].Message)
+		assert.Equal(t, "not started: context deadline exceeded", results[1].Message)
+	})
+
+	t.Run("TimeoutIsNotInterrupt", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		failing := check.New("failing", "custom", "", func(ctx context.Context, env *check.Env) error {
+			return ctx.Err()
+		})
+		result := check.Run(ctx, failing, &check.Env{})
+		assert.Equal(t, check.StatusFailed, result.Status)
+	})
+}
+
+func TestEnvName(t *testing.T) {
+	env := &check.Env{RunID: "abc123"}
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		name := env.Name("test-pvc")
+		assert.True(t, strings.HasPrefix(name, "test-pvc-abc123-"), name)
+		assert.False(t, seen[name], "duplicate name %s", name)
+		seen[name] = true
+	}
+
+	name := (&check.Env{}).Name("test-pvc")
+	assert.True(t, strings.HasPrefix(name, "test-pvc-"), name)
+}
+
+func TestEnvSelector(t *testing.T) {
+	env := &check.Env{RunID: "abc123"}
+	selector := env.Selector("test-deployment")
+	assert.Equal(t, map[string]string{"app": "test-deployment", testrun.LabelRunID: "abc123"}, selector)
+
+	other := &check.Env{RunID: "def456"}
+	assert.NotEqual(t, selector, other.Selector("test-deployment"))
+
+	labels := env.Labels(selector)
+	assert.Equal(t, "ktest", labels[testrun.LabelManagedBy])
+	assert.Equal(t, "test-deployment", labels["app"])
+}
+
+func TestEnvCleanup(t *testing.T) {
+	calls := 0
+	del := func(ctx context.Context) error {
+		calls++
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+		return nil
+	}
+
+	(&check.Env{}).Cleanup("pod", "test", del)
+	assert.Equal(t, 1, calls)
+
+	(&check.Env{KeepResources: true}).Cleanup("pod", "test", del)
+	assert.Equal(t, 1, calls)
+}
+
+func TestEnvNotes(t *testing.T) {
+	noting := check.New("noting", "custom", "", func(ctx context.Context, env *check.Env) error {
+		env.Notef("latency %s", "1ms")
+		env.Notef("retries %d", 0)
+		return nil
+	})
+	env := &check.Env{}
+	result := check.Run(context.Background(), noting, env)
+	assert.Equal(t, check.StatusPassed, result.Status)
+	assert.Equal(t, "latency 1ms; retries 0", result.Message)
+
+	// Notes do not leak into the next check run with the same env.
+	failing := check.New("failing", "custom", "", func(ctx context.Context, env *check.Env) error {
+		env.Notef("attempted 3 times")
+		return errors.New("boom")
+	})
+	result = check.Run(context.Background(), failing, env)
+	assert.Equal(t, "boom; attempted 3 times", result.Message)
+}
+
+func TestSkip(t *testing.T) {
+	skipping := check.New("skipping", "custom", "", func(ctx context.Context, env *check.Env) error {
+		return fmt.Errorf("no controller: %w", check.Skip("no %s controller", "load balancer"))
+	})
+	result := check.Run(context.Background(), skipping, &check.Env{})
+	assert.Equal(t, check.StatusSkipped, result.Status)
+	assert.Equal(t, "no load balancer controller", result.Message)
+}
@@ -0,0 +1,175 @@
+package unit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestConfigLoad(t *testing.T) {
+	t.Run("ShippedConfigs", func(t *testing.T) {
+		cfg, err := config.Load("../../configs/tests")
+		require.NoError(t, err)
+
+		dns, ok := cfg.Lookup("dns-resolution")
+		require.True(t, ok)
+		assert.True(t, dns.IsEnabled())
+		assert.Equal(t, 60*time.Second, dns.Settings().Timeout)
+
+		pvc, ok := cfg.Lookup("pvc-creation")
+		require.True(t, ok)
+		assert.Equal(t, "standard", pvc.Settings().StorageClass)
+		assert.Equal(t, "1Gi", pvc.Settings().Size)
+
+		deployment, ok := cfg.Lookup("deployment")
+		require.True(t, ok)
+		assert.Equal(t, int32(3), deployment.Settings().Replicas)
+
+		benchmark, ok := cfg.Lookup("dns-benchmark")
+		require.True(t, ok)
+		assert.Equal(t, 200, benchmark.Settings().Lookups)
+		assert.Equal(t, time.Second, benchmark.Settings().Thresholds.P99Latency)
+		assert.Equal(t, 1.0, benchmark.Settings().Thresholds.ErrorRate)
+
+		// Every shipped entry configures a registered check.
+		for _, name := range cfg.Names() {
+			_, ok := check.DefaultRegistry.Get(name)
+			assert.True(t, ok, "config entry %s does not match a registered check", name)
+		}
+	})
+
+	t.Run("ImageAndThroughput", func(t *testing.T) {
+		path := writeConfig(t, t.TempDir(), "networking.yaml", `
+tests:
+  - name: pod-throughput
+    image: registry.example/netperf:v1
+    thresholds:
+      minThroughput: 2.5
+`)
+		cfg, err := config.Load(path)
+		require.NoError(t, err)
+
+		throughput, ok := cfg.Lookup("pod-throughput")
+		require.True(t, ok)
+		assert.Equal(t, "registry.example/netperf:v1", throughput.Settings().Image)
+		assert.Equal(t, 2.5, throughput.Settings().Thresholds.MinThroughput)
+	})
+
+	t.Run("Targets", func(t *testing.T) {
+		path := writeConfig(t, t.TempDir(), "networking.yaml", `
+tests:
+  - name: egress
+    targets:
+      - https://registry.k8s.io/
+      - proxy.example.com:3128
+`)
+		cfg, err := config.Load(path)
+		require.NoError(t, err)
+
+		egress, ok := cfg.Lookup("egress")
+		require.True(t, ok)
+		assert.Equal(t, []string{"https://registry.k8s.io/", "proxy.example.com:3128"}, egress.Settings().Targets)
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		path := writeConfig(t, t.TempDir(), "networking.yaml", `
+tests:
+  - name: egress
+    proxy:
+      httpProxy: http://proxy.example.com:3128
+      httpsProxy: http://proxy.example.com:3128
+      noProxy: .svc,10.0.0.0/8
+`)
+		cfg, err := config.Load(path)
+		require.NoError(t, err)
+
+		egress, ok := cfg.Lookup("egress")
+		require.True(t, ok)
+		assert.Equal(t, check.Proxy{
+			HTTP:    "http://proxy.example.com:3128",
+			HTTPS:   "http://proxy.example.com:3128",
+			NoProxy: ".svc,10.0.0.0/8",
+		}, egress.Settings().Proxy)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		path := writeConfig(t, t.TempDir(), "networking.yaml", `
+tests:
+  - name: pod-to-pod
+    enabled: false
+`)
+		cfg, err := config.Load(path)
+		require.NoError(t, err)
+
+		podToPod, ok := cfg.Lookup("pod-to-pod")
+		require.True(t, ok)
+		assert.False(t, podToPod.IsEnabled())
+
+		_, ok = cfg.Lookup("dns-resolution")
+		assert.False(t, ok)
+	})
+
+	t.Run("Critical", func(t *testing.T) {
+		path := writeConfig(t, t.TempDir(), "storage.yaml", `
+tests:
+  - name: pvc-creation
+    critical: true
+  - name: deployment
+    critical: false
+  - name: statefulset
+`)
+		cfg, err := config.Load(path)
+		require.NoError(t, err)
+
+		pvc, _ := cfg.Lookup("pvc-creation")
+		assert.True(t, pvc.IsCritical(false))
+		deployment, _ := cfg.Lookup("deployment")
+		assert.False(t, deployment.IsCritical(true))
+		statefulset, _ := cfg.Lookup("statefulset")
+		assert.True(t, statefulset.IsCritical(true))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		dir := t.TempDir()
+		for name, content := range map[string]string{
+			"unknown-field.yaml":  "tests:\n  - name: dns-resolution\n    timout: 10s\n",
+			"bad-timeout.yaml":    "tests:\n  - name: dns-resolution\n    timeout: soon\n",
+			"bad-replicas.yaml":   "tests:\n  - name: deployment\n    replicas: 0\n",
+			"bad-size.yaml":       "tests:\n  - name: pvc-creation\n    size: big\n",
+			"bad-lookups.yaml":    "tests:\n  - name: dns-benchmark\n    lookups: 0\n",
+			"bad-threshold.yaml":  "tests:\n  - name: dns-benchmark\n    thresholds:\n      errorRate: 150\n",
+			"bad-throughput.yaml": "tests:\n  - name: pod-throughput\n    thresholds:\n      minThroughput: 0\n",
+			"bad-proxy.yaml":      "tests:\n  - name: egress\n    proxy:\n      httpsProxy: proxy.example.com:3128\n",
+			"no-name.yaml":        "tests:\n  - enabled: true\n",
+		} {
+			_, err := config.Load(writeConfig(t, dir, name, content))
+			assert.Error(t, err, name)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		dir := t.TempDir()
+		writeConfig(t, dir, "a.yaml", "tests:\n  - name: deployment\n")
+		writeConfig(t, dir, "b.yaml", "tests:\n  - name: deployment\n")
+		_, err := config.Load(dir)
+		assert.Error(t, err)
+	})
+
+	t.Run("MissingPath", func(t *testing.T) {
+		_, err := config.Load("/nonexistent/config.yaml")
+		assert.Error(t, err)
+	})
+}
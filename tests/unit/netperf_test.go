@@ -0,0 +1,169 @@
+package unit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/netperf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetperf(t *testing.T) {
+	server, err := netperf.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.Serve(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+	address := server.Addr().String()
+
+	t.Run("TCP", func(t *testing.T) {
+		result, err := netperf.Run(ctx, netperf.Options{Server: address, Protocol: netperf.TCP, Duration: 200 * time.Millisecond})
+		require.NoError(t, err)
+		assert.Equal(t, netperf.TCP, result.Protocol)
+		assert.Positive(t, result.Bytes)
+		assert.Positive(t, result.Gbps())
+		assert.Zero(t, result.Packets)
+	})
+
+	t.Run("UDP", func(t *testing.T) {
+		result, err := netperf.Run(ctx, netperf.Options{
+			Server:    address,
+			Protocol:  netperf.UDP,
+			Duration:  500 * time.Millisecond,
+			Bandwidth: 10e6,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, netperf.UDP, result.Protocol)
+		// 10 Mbit/s of 1400 byte datagrams is about 446 in 500ms.
+		assert.InDelta(t, 446, result.Packets+result.Lost, 20)
+		assert.Less(t, result.LossPercent(), 5.0)
+		assert.InDelta(t, 10e6, result.BitsPerSecond, 2e6)
+	})
+
+	t.Run("BandwidthTooHigh", func(t *testing.T) {
+		_, err := netperf.Run(ctx, netperf.Options{Server: address, Protocol: netperf.UDP, Duration: time.Second, Bandwidth: 1e20})
+		assert.ErrorContains(t, err, "too high to pace 1400 byte datagrams")
+	})
+
+	t.Run("UnknownProtocol", func(t *testing.T) {
+		_, err := netperf.Run(ctx, netperf.Options{Server: address, Protocol: "sctp", Duration: time.Second})
+		assert.ErrorContains(t, err, `unknown protocol "sctp"`)
+	})
+
+	t.Run("NoServer", func(t *testing.T) {
+		_, err := netperf.Run(ctx, netperf.Options{Server: "127.0.0.1:1", Protocol: netperf.TCP, Duration: time.Second})
+		assert.ErrorContains(t, err, "failed to connect to 127.0.0.1:1")
+	})
+}
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("URL", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		// The test certificate is not trusted, so the handshake runs but
+		// fails verification.
+		result := netperf.Probe(ctx, server.URL, time.Second)
+		assert.False(t, result.Reachable)
+		assert.Positive(t, result.Connect)
+		assert.Positive(t, result.TLS)
+		assert.Contains(t, result.Error, "certificate")
+
+		plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer plain.Close()
+		result = netperf.Probe(ctx, plain.URL, time.Second)
+		assert.True(t, result.Reachable, result.Error)
+		assert.Equal(t, http.StatusForbidden, result.Status)
+		assert.Zero(t, result.TLS)
+		assert.Zero(t, result.DNS)
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		var requested []string
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.URL.String())
+			if r.URL.Host == "blocked.example.com" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer proxy.Close()
+		t.Setenv("HTTP_PROXY", proxy.URL)
+
+		result := netperf.Probe(ctx, "http://allowed.example.com/", time.Second)
+		assert.True(t, result.Reachable, result.Error)
+		assert.Equal(t, http.StatusOK, result.Status)
+
+		result = netperf.Probe(ctx, "http://blocked.example.com/", time.Second)
+		assert.False(t, result.Reachable)
+		assert.Equal(t, http.StatusBadGateway, result.Status)
+		assert.Equal(t, "proxy "+proxy.URL+" answered 502 Bad Gateway", result.Error)
+		assert.Equal(t, []string{"http://allowed.example.com/", "http://blocked.example.com/"}, requested)
+	})
+
+	t.Run("HostPort", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+		result := netperf.Probe(ctx, "localhost:"+port, time.Second)
+		assert.True(t, result.Reachable, result.Error)
+		assert.Positive(t, result.DNS)
+		assert.Positive(t, result.Connect)
+		assert.Zero(t, result.Status)
+
+		listener.Close()
+		result = netperf.Probe(ctx, "127.0.0.1:"+port, time.Second)
+		assert.False(t, result.Reachable)
+		assert.Contains(t, result.Error, "connection refused")
+	})
+
+	t.Run("ValidateTarget", func(t *testing.T) {
+		for _, target := range []string{"https://example.com/", "http://10.0.0.1:8080/x", "example.com:443", "[::1]:80"} {
+			assert.NoError(t, netperf.ValidateTarget(target), target)
+		}
+		for _, target := range []string{"ftp://example.com/", "https://", "example.com", ":80"} {
+			assert.Error(t, netperf.ValidateTarget(target), target)
+		}
+	})
+}
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+
+	// 70000 bytes do not fit an IP packet, so the send fails rather than
+	// being fragmented.
+	results, err := netperf.Ping(ctx, "127.0.0.1", []int{56, 1472, 70000}, time.Second)
+	if err != nil && (strings.Contains(err.Error(), "permission") || strings.Contains(err.Error(), "not permitted")) {
+		t.Skipf("no ICMP socket available: %v", err)
+	}
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	for _, result := range results[:2] {
+		assert.True(t, result.Replied, "size %d: %s", result.Size, result.Error)
+		assert.Positive(t, result.RTT)
+	}
+	assert.False(t, results[2].Replied)
+	assert.Equal(t, "failed to send: message too long", results[2].Error)
+
+	_, err = netperf.Ping(ctx, "localhost", []int{56}, time.Second)
+	assert.ErrorContains(t, err, `invalid IP address "localhost"`)
+}
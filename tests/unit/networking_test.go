@@ -2,54 +2,1864 @@ package unit
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/netperf"
 	"github.com/denhamparry/kubernetes-testing/pkg/networking"
+	"github.com/denhamparry/kubernetes-testing/pkg/performance"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
 	k8stesting "k8s.io/client-go/testing"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
-func TestNetworkingFunctions(t *testing.T) {
-	// Create a fake clientset for testing
+// runningPods makes every created pod report itself as running and ready
+// with a unique pod IP.
+func runningPods(clientset *fake.Clientset) {
+	var n atomic.Int32
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.PodIP = fmt.Sprintf("10.0.0.%d", n.Add(1))
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		return false, nil, nil
+	})
+}
+
+var probeURL = regexp.MustCompile(`'(http://[^']+)'`)
+
+// fakeWget returns an executor that answers the probe script run in client
+// pods. respond gives the body of each request from pod to url, or the wget
+// error output for requests that should fail. Every request takes 1.5ms.
+func fakeWget(respond func(pod, url string) (body, failure string)) check.Executor {
+	return check.ExecFunc(func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+		script := command[len(command)-1]
+		if !strings.Contains(script, "wget") {
+			return "", "unexpected command", utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code 1"), Code: 1}
+		}
+		var out strings.Builder
+		for _, match := range probeURL.FindAllStringSubmatch(script, -1) {
+			body, failure := respond(pod, match[1])
+			rc := 0
+			if failure != "" {
+				rc, body = 1, failure
+			}
+			fmt.Fprintf(&out, "%s %d %d %s\n", match[1], rc, (1500 * time.Microsecond).Nanoseconds(), body)
+		}
+		return out.String(), "", nil
+	})
+}
+
+// kubernetesService returns the default kubernetes Service with the given
+// cluster IP.
+func kubernetesService(clusterIP string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "kubernetes", Namespace: metav1.NamespaceDefault},
+		Spec:       corev1.ServiceSpec{ClusterIP: clusterIP, ClusterIPs: []string{clusterIP}},
+	}
+}
+
+// fakeNslookup answers resolv.conf reads with the default pod resolver
+// configuration and nslookup queries with busybox output built from the
+// answer section respond returns. Answers without addresses exit 1.
+func fakeNslookup(respond func(qtype, name string) string) check.Executor {
+	return check.ExecFunc(func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+		switch command[0] {
+		case "cat":
+			return "search " + namespace + ".svc.cluster.local svc.cluster.local cluster.local\n" +
+				"nameserver 10.96.0.10\noptions ndots:5\n", "", nil
+		case "nslookup":
+			qtype := strings.TrimPrefix(command[1], "-type=")
+			answer := respond(qtype, command[2])
+			out := "Server:\t\t10.96.0.10\nAddress:\t10.96.0.10:53\n\n" + answer
+			if !strings.Contains(answer, "Name:") && !strings.Contains(answer, " = ") {
+				return out, "", utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code 1"), Code: 1}
+			}
+			return out, "", nil
+		}
+		return "", "unexpected command", utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code 1"), Code: 1}
+	})
+}
+
+// clusterDNS answers queries from the services and pods in the fake
+// clientset like CoreDNS with the cluster.local domain, expanding short
+// names with the default namespace's search path. kubernetes.io resolves to
+// 203.0.113.1.
+func clusterDNS(t *testing.T, clientset *fake.Clientset) func(qtype, name string) string {
+	return func(qtype, name string) string {
+		ctx := context.Background()
+		const suffix = ".svc.cluster.local"
+		if name == "kubernetes.io." {
+			return "Name:\tkubernetes.io\nAddress: 203.0.113.1\n"
+		}
+		switch strings.Count(name, ".") {
+		case 0:
+			name += ".default" + suffix
+		case 1:
+			name += suffix
+		}
+		parts := strings.Split(strings.TrimSuffix(name, suffix), ".")
+		if len(parts) < 2 {
+			return ""
+		}
+		namespace := parts[len(parts)-1]
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, parts[len(parts)-2], metav1.GetOptions{})
+		if err != nil {
+			return ""
+		}
+		address := func(ip string) string { return fmt.Sprintf("Name:\t%s\nAddress: %s\n", name, ip) }
+		pods := func() []corev1.Pod {
+			list, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+				LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+			})
+			require.NoError(t, err)
+			return list.Items
+		}
+
+		switch {
+		case qtype == "srv" && len(parts) == 4:
+			return fmt.Sprintf("%s\tservice = 0 100 %d %s.%s%s\n", name, svc.Spec.Ports[0].Port, svc.Name, namespace, suffix)
+		case qtype == "cname" && svc.Spec.Type == corev1.ServiceTypeExternalName:
+			return fmt.Sprintf("%s\tcanonical name = %s\n", name, svc.Spec.ExternalName)
+		case qtype != "a":
+		case len(parts) == 3:
+			// A per-pod record of a headless service.
+			for _, pod := range pods() {
+				if pod.Spec.Hostname == parts[0] || strings.ReplaceAll(pod.Status.PodIP, ".", "-") == parts[0] {
+					return address(pod.Status.PodIP)
+				}
+			}
+		case svc.Spec.ClusterIP == corev1.ClusterIPNone:
+			var out strings.Builder
+			for _, pod := range pods() {
+				out.WriteString(address(pod.Status.PodIP))
+			}
+			return out.String()
+		case len(parts) == 2:
+			return address(svc.Spec.ClusterIP)
+		}
+		return ""
+	}
+}
+
+// probePods makes probe daemonsets report one ready pod per node and creates
+// those pods, with pod IPs 10.1.0.N and node IPs 192.168.0.N. Pods on nodes
+// in notReady get that status instead.
+func probePods(t *testing.T, nodes []string, notReady map[string]corev1.PodStatus) *fake.Clientset {
 	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "daemonsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		ds := action.(k8stesting.CreateAction).GetObject().(*appsv1.DaemonSet)
+		ds.Status.DesiredNumberScheduled = int32(len(nodes))
+		ds.Status.NumberReady = int32(len(nodes))
+
+		for i, node := range nodes {
+			ip := fmt.Sprintf("10.1.0.%d", i+1)
+			if ds.Spec.Template.Spec.HostNetwork {
+				ip = fmt.Sprintf("192.168.0.%d", i+1)
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-%s", ds.Name, node),
+					Namespace: ds.Namespace,
+					Labels:    ds.Spec.Template.Labels,
+				},
+				Spec: corev1.PodSpec{NodeName: node},
+				Status: corev1.PodStatus{
+					Phase:      corev1.PodRunning,
+					PodIP:      ip,
+					Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+				},
+			}
+			if status, ok := notReady[node]; ok {
+				pod.Status = status
+			}
+			if err := clientset.Tracker().Add(pod); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return false, nil, nil
+	})
+	return clientset
+}
+
+// serviceEndpoints gives created services a cluster IP, and node port 30080
+// where needed, and answers EndpointSlice lists with the pods each service
+// selects, all ready.
+func serviceEndpoints(clientset *fake.Clientset) {
+	clientset.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		svc := action.(k8stesting.CreateAction).GetObject().(*corev1.Service)
+		if svc.Spec.ClusterIP != corev1.ClusterIPNone && svc.Spec.Type != corev1.ServiceTypeExternalName {
+			svc.Spec.ClusterIP = "10.96.0.10"
+		}
+		if svc.Spec.Type == corev1.ServiceTypeNodePort || svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			svc.Spec.Ports[0].NodePort = 30080
+		}
+		return false, nil, nil
+	})
+	clientset.PrependReactor("list", "endpointslices", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		list := &discoveryv1.EndpointSliceList{}
+		services, err := clientset.Tracker().List(corev1.SchemeGroupVersion.WithResource("services"), corev1.SchemeGroupVersion.WithKind("Service"), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		pods, err := clientset.Tracker().List(corev1.SchemeGroupVersion.WithResource("pods"), corev1.SchemeGroupVersion.WithKind("Pod"), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		for _, svc := range services.(*corev1.ServiceList).Items {
+			slice := discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   svc.Name + "-abcde",
+					Labels: map[string]string{discoveryv1.LabelServiceName: svc.Name},
+				},
+			}
+			for _, pod := range pods.(*corev1.PodList).Items {
+				if labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+					slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+						Addresses: []string{pod.Status.PodIP},
+						TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: pod.Name},
+					})
+				}
+			}
+			list.Items = append(list.Items, slice)
+		}
+		return true, list, nil
+	})
+}
+
+// roundRobinBackends answers requests with the name of each service backend
+// pod in turn, like kube-proxy spreading connections.
+func roundRobinBackends(clientset *fake.Clientset, requested *[]string) check.Executor {
+	n := 0
+	return fakeWget(func(pod, url string) (string, string) {
+		*requested = append(*requested, url)
+		pods, err := clientset.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{LabelSelector: "app"})
+		if err != nil || len(pods.Items) == 0 {
+			return "", "wget: can't connect to remote host: Connection refused"
+		}
+		n++
+		return pods.Items[n%len(pods.Items)].Name, ""
+	})
+}
+
+// testNode returns a node with the given internal and optional external IP.
+func testNode(name, internalIP, externalIP string) *corev1.Node {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: internalIP}}
+	if externalIP != "" {
+		node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: externalIP})
+	}
+	return node
+}
+
+func TestExposedServices(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("NodePort", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			testNode("node-a", "192.168.0.1", ""),
+			testNode("node-b", "192.168.0.2", ""),
+		)
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{Clientset: clientset, Executor: roundRobinBackends(clientset, &requested), Namespace: "default"}
+
+		result := check.Run(ctx, check.New("nodeport-service", "networking", "", networking.TestNodePortService), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "node port 30080 reachable from pods on 2 nodes")
+		assert.Equal(t, []string{"http://192.168.0.1:30080/", "http://192.168.0.2:30080/"}, requested)
+	})
+
+	t.Run("NodePortUnreachableNode", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			testNode("node-a", "192.168.0.1", ""),
+			testNode("node-b", "192.168.0.2", ""),
+		)
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor: fakeWget(func(pod, url string) (string, string) {
+				if strings.Contains(url, "192.168.0.2") {
+					return "", "wget: can't connect to remote host (192.168.0.2): Connection refused"
+				}
+				pods, _ := clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{LabelSelector: "app"})
+				return pods.Items[0].Name, ""
+			}),
+			Namespace: "default",
+		}
+
+		err := networking.TestNodePortService(ctx, env)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "node port 30080 failed from pods on 1 of 2 nodes: node-b: http://192.168.0.2:30080/: connection refused")
+	})
+
+	t.Run("NodePortFromHost", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "ok")
+		}))
+		defer server.Close()
+		_, port, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+		require.NoError(t, err)
+		nodePort, err := strconv.Atoi(port)
+		require.NoError(t, err)
+
+		clientset := fake.NewSimpleClientset(testNode("node-a", "192.168.0.1", "127.0.0.1"))
+		// Serve the node port from the test server. Reactors added later run
+		// first, so this one must come before serviceEndpoints.
+		clientset.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			svc := action.(k8stesting.CreateAction).GetObject().(*corev1.Service)
+			svc.Spec.Ports[0].NodePort = int32(nodePort)
+			return false, nil, nil
+		})
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  roundRobinBackends(clientset, &requested),
+			Namespace: "default",
+			Settings:  check.Settings{ProbeFromHost: true},
+		}
+
+		result := check.Run(ctx, check.New("nodeport-service", "networking", "", networking.TestNodePortService), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "reachable from this host")
+
+		server.Close()
+		err = networking.TestNodePortService(ctx, env)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "from this host on 1 nodes: node-a")
+		assert.Contains(t, err.Error(), "connection refused")
+	})
+
+	t.Run("LoadBalancer", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			svc := action.(k8stesting.CreateAction).GetObject().(*corev1.Service)
+			svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}
+			return false, nil, nil
+		})
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{Clientset: clientset, Executor: roundRobinBackends(clientset, &requested), Namespace: "default"}
+
+		result := check.Run(ctx, check.New("loadbalancer-service", "networking", "", networking.TestLoadBalancerService), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "http://203.0.113.10:80/: 30 requests, spread 10/10/10")
+	})
+
+	t.Run("LoadBalancerWithoutController", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  roundRobinBackends(clientset, &requested),
+			Namespace: "default",
+			Settings:  check.Settings{Timeout: time.Second},
+		}
+
+		result := check.Run(ctx, check.New("loadbalancer-service", "networking", "", networking.TestLoadBalancerService), env)
+		assert.Equal(t, check.StatusSkipped, result.Status, result.Message)
+		assert.Contains(t, result.Message, "no load balancer controller")
+	})
+
+	t.Run("LoadBalancerNotProvisioned", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(&corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "lb-event", Namespace: "default"},
+			InvolvedObject: corev1.ObjectReference{Kind: "Service"},
+			Reason:         "SyncLoadBalancerFailed",
+			Message:        "quota exceeded",
+		})
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  roundRobinBackends(clientset, &requested),
+			Namespace: "default",
+			Settings:  check.Settings{Timeout: time.Second},
+		}
+
+		result := check.Run(ctx, check.New("loadbalancer-service", "networking", "", networking.TestLoadBalancerService), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "SyncLoadBalancerFailed: quota exceeded")
+	})
+}
+
+// policyCNI answers requests like a CNI that enforces the policies created by
+// the network-policy check once any exist, or ignores them if enforce is
+// false.
+func policyCNI(clientset *fake.Clientset, enforce bool) check.Executor {
+	return fakeWget(func(pod, url string) (string, string) {
+		ctx := context.Background()
+		pods, _ := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+		target := ""
+		for _, p := range pods.Items {
+			if strings.Contains(url, "//"+p.Status.PodIP+":") {
+				target = p.Name
+			}
+		}
+		policies, _ := clientset.NetworkingV1().NetworkPolicies("").List(ctx, metav1.ListOptions{})
+		if enforce && len(policies.Items) > 0 {
+			denied := strings.HasPrefix(target, "netpol-server-") &&
+				(strings.HasPrefix(pod, "netpol-denied-") || strings.HasPrefix(pod, "netpol-peer-denied-"))
+			egress := strings.HasPrefix(target, "netpol-other-") && strings.HasPrefix(pod, "netpol-egress-")
+			if denied || egress {
+				return "", "wget: download timed out"
+			}
+		}
+		return target, ""
+	})
+}
+
+// dualStack gives nodes IPv4 and IPv6 pod CIDRs, pods an fd00::N address
+// next to their IPv4 one and dual-stack services both cluster IPs. It must be
+// called before runningPods and serviceEndpoints so that it runs after them.
+func dualStack(clientset *fake.Clientset, podIPv6 bool) {
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status.PodIPs = []corev1.PodIP{{IP: pod.Status.PodIP}}
+		if podIPv6 {
+			pod.Status.PodIPs = append(pod.Status.PodIPs, corev1.PodIP{IP: "fd00::" + strings.TrimPrefix(pod.Status.PodIP, "10.0.0.")})
+		}
+		return false, nil, nil
+	})
+	clientset.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		svc := action.(k8stesting.CreateAction).GetObject().(*corev1.Service)
+		svc.Spec.ClusterIPs = []string{svc.Spec.ClusterIP, "fd00:96::10"}
+		return false, nil, nil
+	})
+}
+
+func TestDualStack(t *testing.T) {
+	ctx := context.Background()
+	node := func(name string, cidrs ...string) *corev1.Node {
+		node := testNode(name, "192.168.0.1", "")
+		node.Spec.PodCIDRs = cidrs
+		return node
+	}
+
+	t.Run("DualStack", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			node("node-a", "10.244.0.0/24", "fd00:244::/64"),
+			node("node-b", "10.244.1.0/24", "fd00:244:0:1::/64"),
+		)
+		dualStack(clientset, true)
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{Clientset: clientset, Executor: roundRobinBackends(clientset, &requested), Namespace: "default"}
 
-	// Add a reactor to simulate pod status changes
-	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (handled bool, ret runtime.Object, err error) {
-		getAction := action.(k8stesting.GetAction)
-		pod := &corev1.Pod{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      getAction.GetName(),
-				Namespace: getAction.GetNamespace(),
+		result := check.Run(ctx, check.New("dual-stack", "networking", "", networking.TestDualStack), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "IPv4: pod-to-pod up to 1.5ms, ClusterIP 10.96.0.10 30 requests, spread 10/10/10")
+		assert.Contains(t, result.Message, "IPv6: pod-to-pod up to 1.5ms, ClusterIP fd00:96::10 30 requests")
+		assert.Contains(t, requested, "http://[fd00::1]:8080/")
+		assert.Contains(t, requested, "http://[fd00:96::10]:80/")
+
+		services, err := clientset.CoreV1().Services("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		for _, svc := range services.Items {
+			assert.Equal(t, corev1.IPFamilyPolicyRequireDualStack, *svc.Spec.IPFamilyPolicy)
+		}
+	})
+
+	t.Run("PodWithoutIPv6", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(node("node-a", "10.244.0.0/24", "fd00:244::/64"))
+		dualStack(clientset, false)
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{Clientset: clientset, Executor: roundRobinBackends(clientset, &requested), Namespace: "default"}
+
+		result := check.Run(ctx, check.New("dual-stack", "networking", "", networking.TestDualStack), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "has no IPv6 address (pod IPs: 10.0.0.")
+	})
+
+	t.Run("SingleStack", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(node("node-a", "10.244.0.0/24"))
+		env := &check.Env{Clientset: clientset, Namespace: "default"}
+
+		result := check.Run(ctx, check.New("dual-stack", "networking", "", networking.TestDualStack), env)
+		assert.Equal(t, check.StatusSkipped, result.Status)
+		assert.Contains(t, result.Message, "cluster is not dual-stack: pod CIDRs 10.244.0.0/24, service CIDRs unknown")
+	})
+}
+
+var hostHeader = regexp.MustCompile(`--header 'Host: ([^']+)'`)
+
+// fakeRouter answers requests like an ingress controller: route returns the
+// service a host and path are routed to, and the request is answered by the
+// first pod that service selects, or fails with 404 when it returns "".
+func fakeRouter(clientset *fake.Clientset, route func(host, path string) string) check.Executor {
+	return check.ExecFunc(func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+		host := ""
+		if match := hostHeader.FindStringSubmatch(command[len(command)-1]); match != nil {
+			host = match[1]
+		}
+		return fakeWget(func(pod, url string) (string, string) {
+			path := "/" + strings.SplitN(strings.TrimPrefix(url, "http://"), "/", 2)[1]
+			service := route(host, path)
+			if service == "" {
+				return "", "wget: server returned error: HTTP/1.1 404 Not Found"
+			}
+			svc, err := clientset.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+			if err != nil {
+				return "", "wget: server returned error: HTTP/1.1 503 Service Unavailable"
+			}
+			pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+				LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+			})
+			if err != nil || len(pods.Items) == 0 {
+				return "", "wget: server returned error: HTTP/1.1 503 Service Unavailable"
+			}
+			return pods.Items[0].Name, ""
+		}).Exec(ctx, namespace, pod, container, command)
+	})
+}
+
+// longestPrefix returns the service of the longest prefix matching path.
+func longestPrefix(path string, services map[string]string) string {
+	best := ""
+	for prefix := range services {
+		if (path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	return services[best]
+}
+
+func TestIngress(t *testing.T) {
+	ctx := context.Background()
+	defaultClass := &networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{
+		Name:        "nginx",
+		Annotations: map[string]string{"ingressclass.kubernetes.io/is-default-class": "true"},
+	}}
+	// ingressController assigns ingresses an address and routes by their
+	// rules, or sends everything to the first path's service when broken.
+	ingressController := func(clientset *fake.Clientset, broken bool) check.Executor {
+		clientset.PrependReactor("create", "ingresses", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			ingress := action.(k8stesting.CreateAction).GetObject().(*networkingv1.Ingress)
+			ingress.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "172.18.0.100"}}
+			return false, nil, nil
+		})
+		return fakeRouter(clientset, func(host, path string) string {
+			ingresses, err := clientset.NetworkingV1().Ingresses("default").List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+			for _, ingress := range ingresses.Items {
+				for _, rule := range ingress.Spec.Rules {
+					if rule.Host != host {
+						continue
+					}
+					services := map[string]string{}
+					for _, p := range rule.HTTP.Paths {
+						services[p.Path] = p.Backend.Service.Name
+					}
+					if broken {
+						return rule.HTTP.Paths[0].Backend.Service.Name
+					}
+					return longestPrefix(path, services)
+				}
+			}
+			return ""
+		})
+	}
+
+	t.Run("Routed", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(defaultClass)
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		env := &check.Env{Clientset: clientset, Executor: ingressController(clientset, false), Namespace: "default"}
+
+		result := check.Run(ctx, check.New("ingress", "networking", "", networking.TestIngress), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "ingress class nginx assigned 172.18.0.100")
+		assert.Contains(t, result.Details, "unrouted.ktest.example/")
+	})
+
+	t.Run("Misrouted", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(defaultClass)
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  ingressController(clientset, true),
+			Namespace: "default",
+			Settings:  check.Settings{Timeout: time.Second},
+		}
+
+		result := check.Run(ctx, check.New("ingress", "networking", "", networking.TestIngress), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "1 of 3 requests to http://172.18.0.100:80 not routed as expected")
+		assert.Regexp(t, `/ktest/ +expected one of 3 backends, answered by test-service-backend-`, result.Details)
+	})
+
+	t.Run("NoIngressClass", func(t *testing.T) {
+		env := &check.Env{Clientset: fake.NewSimpleClientset(), Namespace: "default"}
+
+		result := check.Run(ctx, check.New("ingress", "networking", "", networking.TestIngress), env)
+		assert.Equal(t, check.StatusSkipped, result.Status)
+		assert.Contains(t, result.Message, "no IngressClass is installed")
+	})
+}
+
+func TestGatewayHTTPRoute(t *testing.T) {
+	ctx := context.Background()
+	gateways := schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+	httpRoutes := schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+	gateway := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       "Gateway",
+		"metadata":   map[string]interface{}{"name": "shared", "namespace": "gateways"},
+		"spec": map[string]interface{}{
+			"listeners": []interface{}{
+				map[string]interface{}{"name": "https", "protocol": "HTTPS", "port": int64(443)},
+				map[string]interface{}{
+					"name": "http", "protocol": "HTTP", "port": int64(8000), "hostname": "*.apps.example",
+					"allowedRoutes": map[string]interface{}{"namespaces": map[string]interface{}{"from": "All"}},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"addresses":  []interface{}{map[string]interface{}{"value": "172.18.0.200"}},
+			"conditions": []interface{}{map[string]interface{}{"type": "Programmed", "status": "True"}},
+		},
+	}}
+	// gatewayAPI serves the Gateway API resources and accepts routes with
+	// the given status, routing them by their rules.
+	gatewayAPI := func(clientset *fake.Clientset, accepted string) (*dynamicfake.FakeDynamicClient, check.Executor) {
+		clientset.Resources = []*metav1.APIResourceList{{
+			GroupVersion: "gateway.networking.k8s.io/v1",
+			APIResources: []metav1.APIResource{{Name: "gateways"}, {Name: "httproutes"}},
+		}}
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{gateways: "GatewayList", httpRoutes: "HTTPRouteList"})
+		_, err := dynamicClient.Resource(gateways).Namespace("gateways").Create(ctx, gateway.DeepCopy(), metav1.CreateOptions{})
+		require.NoError(t, err)
+		dynamicClient.PrependReactor("create", "httproutes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			route := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+			parent := map[string]interface{}{
+				"parentRef":  map[string]interface{}{"name": "shared", "namespace": "gateways"},
+				"conditions": []interface{}{map[string]interface{}{"type": "Accepted", "status": accepted, "reason": "NotAllowedByListeners", "message": "no listener matched"}},
+			}
+			require.NoError(t, unstructured.SetNestedSlice(route.Object, []interface{}{parent}, "status", "parents"))
+			return false, nil, nil
+		})
+		return dynamicClient, fakeRouter(clientset, func(host, path string) string {
+			routes, err := dynamicClient.Resource(httpRoutes).Namespace("default").List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+			for _, route := range routes.Items {
+				hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+				if !slices.Contains(hostnames, host) {
+					continue
+				}
+				services := map[string]string{}
+				rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+				for _, r := range rules {
+					rule := r.(map[string]interface{})
+					prefix := rule["matches"].([]interface{})[0].(map[string]interface{})["path"].(map[string]interface{})["value"].(string)
+					services[prefix] = rule["backendRefs"].([]interface{})[0].(map[string]interface{})["name"].(string)
+				}
+				return longestPrefix(path, services)
+			}
+			return ""
+		})
+	}
+
+	t.Run("Routed", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		dynamicClient, executor := gatewayAPI(clientset, "True")
+		env := &check.Env{Clientset: clientset, Dynamic: dynamicClient, Executor: executor, Namespace: "default"}
+
+		result := check.Run(ctx, check.New("gateway-httproute", "networking", "", networking.TestGatewayHTTPRoute), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "gateway gateways/shared listener http accepted the route")
+		assert.Regexp(t, `ktest-route-\w+\.apps\.example/ktest/ +expected one of 3 backends`, result.Details)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		dynamicClient, executor := gatewayAPI(clientset, "False")
+		env := &check.Env{Clientset: clientset, Dynamic: dynamicClient, Executor: executor, Namespace: "default"}
+
+		result := check.Run(ctx, check.New("gateway-httproute", "networking", "", networking.TestGatewayHTTPRoute), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "rejected HTTPRoute ktest-route-")
+		assert.Contains(t, result.Message, "NotAllowedByListeners: no listener matched")
+	})
+
+	t.Run("MalformedGateway", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		dynamicClient, _ := gatewayAPI(clientset, "True")
+		malformed := gateway.DeepCopy()
+		require.NoError(t, unstructured.SetNestedSlice(malformed.Object, []interface{}{"172.18.0.200"}, "status", "addresses"))
+		_, err := dynamicClient.Resource(gateways).Namespace("gateways").Update(ctx, malformed, metav1.UpdateOptions{})
+		require.NoError(t, err)
+		env := &check.Env{Clientset: clientset, Dynamic: dynamicClient, Namespace: "default"}
+
+		result := check.Run(ctx, check.New("gateway-httproute", "networking", "", networking.TestGatewayHTTPRoute), env)
+		assert.Equal(t, check.StatusSkipped, result.Status, result.Message)
+		assert.Contains(t, result.Message, "no programmed Gateway has an HTTP listener")
+	})
+
+	t.Run("NoCRDs", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+		env := &check.Env{Clientset: clientset, Dynamic: dynamicClient, Namespace: "default"}
+
+		result := check.Run(ctx, check.New("gateway-httproute", "networking", "", networking.TestGatewayHTTPRoute), env)
+		assert.Equal(t, check.StatusSkipped, result.Status)
+		assert.Contains(t, result.Message, "Gateway API CRDs")
+	})
+}
+
+func TestNetworkPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Enforced", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		env := &check.Env{Clientset: clientset, Executor: policyCNI(clientset, true), Namespace: "default", RunID: "run1"}
+
+		result := check.Run(ctx, check.New("network-policy", "networking", "", networking.TestNetworkPolicy), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message+"\n"+result.Details)
+		assert.Contains(t, result.Message, "7 paths allowed or blocked as expected")
+		assert.Contains(t, result.Details, "expected blocked, got blocked (timeout)")
+
+		policies, err := clientset.NetworkingV1().NetworkPolicies("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, policies.Items)
+		namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, namespaces.Items)
+	})
+
+	t.Run("NotEnforced", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  policyCNI(clientset, false),
+			Namespace: "default",
+			RunID:     "run1",
+			Settings:  check.Settings{Timeout: time.Second},
+		}
+
+		result := check.Run(ctx, check.New("network-policy", "networking", "", networking.TestNetworkPolicy), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "network policies not enforced after 1s: 3 of 7 paths behave wrongly")
+		assert.Contains(t, result.Details, "unlabelled client -> server")
+		assert.Contains(t, result.Details, "expected blocked, got allowed")
+	})
+}
+
+func TestDNSConformance(t *testing.T) {
+	ctx := context.Background()
+	checks := map[string]check.Func{
+		"dns-service-records":  networking.TestServiceRecords,
+		"dns-headless-records": networking.TestHeadlessRecords,
+		"dns-srv-records":      networking.TestSRVRecords,
+		"dns-pod-hostname":     networking.TestPodHostnameRecords,
+		"dns-externalname":     networking.TestExternalNameRecords,
+		"dns-search-path":      networking.TestSearchPath,
+		"dns-external-lookup":  networking.TestExternalLookup,
+	}
+	for name, fn := range checks {
+		t.Run(name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(kubernetesService("10.96.0.1"))
+			serviceEndpoints(clientset)
+			runningPods(clientset)
+			env := &check.Env{
+				Clientset: clientset,
+				Executor:  fakeNslookup(clusterDNS(t, clientset)),
+				Namespace: "default",
+			}
+
+			result := check.Run(ctx, check.New(name, "networking", "", fn), env)
+			assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		})
+	}
+
+	t.Run("wrong SRV port", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		serviceEndpoints(clientset)
+		runningPods(clientset)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor: fakeNslookup(func(qtype, name string) string {
+				return name + "\tservice = 0 100 8080 " + strings.TrimPrefix(name, "_http._tcp.") + "\n"
+			}),
+			Namespace: "default",
+			Settings:  check.Settings{Timeout: time.Second},
+		}
+
+		result := check.Run(ctx, check.New("dns-srv-records", "networking", "", networking.TestSRVRecords), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "answered 8080 dns-srv-")
+		assert.Contains(t, result.Message, "resolver output: Server: 10.96.0.10")
+	})
+}
+
+func TestDNSBenchmark(t *testing.T) {
+	ctx := context.Background()
+	// lookups answers every lookup in 2ms, except that the first failure
+	// lookups of each pod fail with output.
+	lookups := func(failures int, output string) check.Executor {
+		return check.ExecFunc(func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+			if command[0] == "cat" {
+				return "search default.svc.cluster.local svc.cluster.local cluster.local\nnameserver 10.96.0.10\n", "", nil
+			}
+			script := command[len(command)-1]
+			require.Contains(t, script, "nslookup -type=a 'kubernetes.default.svc.cluster.local.'")
+			count, err := strconv.Atoi(regexp.MustCompile(`seq (\d+)`).FindStringSubmatch(script)[1])
+			require.NoError(t, err)
+			var out strings.Builder
+			for i := range count {
+				if i < failures {
+					fmt.Fprintf(&out, "1 %d %s\n", (5 * time.Second).Nanoseconds(), output)
+					continue
+				}
+				fmt.Fprintf(&out, "0 %d Server: 10.96.0.10 Address: 10.96.0.10:53 Name: kubernetes.default.svc.cluster.local Address: 10.96.0.1\n",
+					(2 * time.Millisecond).Nanoseconds())
+			}
+			return out.String(), "", nil
+		})
+	}
+
+	t.Run("Healthy", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  lookups(0, ""),
+			Namespace: "default",
+			Settings:  check.Settings{Lookups: 50},
+		}
+
+		result := check.Run(ctx, check.New("dns-benchmark", "networking", "", networking.TestDNSBenchmark), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "150 lookups from 3 pods: p50 2ms, p95 2ms, p99 2ms, 0.00% timeouts, 0.00% SERVFAIL")
+		assert.Contains(t, result.Details, "Total Requests:   150")
+		assert.Contains(t, result.Details, "Per node:")
+	})
+
+	t.Run("Timeouts", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  lookups(2, ";; connection timed out; no servers could be reached"),
+			Namespace: "default",
+			Settings:  check.Settings{Replicas: 2, Lookups: 100},
+		}
+
+		result := check.Run(ctx, check.New("dns-benchmark", "networking", "", networking.TestDNSBenchmark), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "DNS thresholds exceeded: p99 latency 5s > 1s, error rate 2.00% > 1.00%")
+		assert.Contains(t, result.Message, "2.00% timeouts, 0.00% SERVFAIL")
+		assert.Contains(t, result.Details, "Timeouts:         4 (2.00%)")
+	})
+
+	t.Run("PartialThresholds", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  lookups(2, ";; connection timed out; no servers could be reached"),
+			Namespace: "default",
+			Settings: check.Settings{
+				Replicas:   2,
+				Lookups:    100,
+				Thresholds: performance.Thresholds{P95Latency: 10 * time.Second},
 			},
-			Status: corev1.PodStatus{
-				Phase: corev1.PodSucceeded,
+		}
+
+		// The unset p99 latency and error rate keep their defaults.
+		result := check.Run(ctx, check.New("dns-benchmark", "networking", "", networking.TestDNSBenchmark), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "DNS thresholds exceeded: p99 latency 5s > 1s, error rate 2.00% > 1.00%")
+	})
+
+	t.Run("SERVFAIL", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  lookups(1, "Server: 10.96.0.10 ** server can't find kubernetes.default.svc.cluster.local: SERVFAIL"),
+			Namespace: "default",
+			Settings: check.Settings{
+				Replicas:   1,
+				Lookups:    100,
+				Thresholds: performance.Thresholds{P99Latency: 10 * time.Second, ErrorRate: 5},
 			},
 		}
-		return true, pod, nil
+
+		result := check.Run(ctx, check.New("dns-benchmark", "networking", "", networking.TestDNSBenchmark), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "1.00% SERVFAIL")
 	})
+}
 
+// fakePath returns an executor for the path-mtu check's client pod with
+// interface MTU mtu. ping returns why a ping of size bytes fails, or "" when
+// it gets through, and transfer how many bytes of a size arrive from base.
+// A ping failure mentioning permission fails the whole netperf ping command.
+func fakePath(mtu int, pinged *[]string, ping func(size int) string, transfer func(base string, size int) int) check.Executor {
+	sizeList := regexp.MustCompile(`for s in ([\d ]+);`)
+	return check.ExecFunc(func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+		latency := time.Millisecond.Nanoseconds()
+		var out strings.Builder
+		switch {
+		case command[0] == "cat":
+			return fmt.Sprintf("%d\n", mtu), "", nil
+		case command[0] == "netperf" && command[1] == "ping":
+			*pinged = command
+			for _, field := range command[5:] {
+				size, _ := strconv.Atoi(field)
+				failure := ping(size)
+				switch {
+				case strings.Contains(failure, "permission"):
+					return "", "Error: " + failure, utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code 1"), Code: 1}
+				case failure != "":
+					fmt.Fprintf(&out, `{"size":%d,"replied":false,"error":%q}`+"\n", size, failure)
+				default:
+					fmt.Fprintf(&out, `{"size":%d,"replied":true,"rtt":%d}`+"\n", size, latency)
+				}
+			}
+			return out.String(), "", nil
+		}
+		script := command[len(command)-1]
+		for _, field := range strings.Fields(sizeList.FindStringSubmatch(script)[1]) {
+			size, _ := strconv.Atoi(field)
+			base := strings.TrimSuffix(probeURL.FindStringSubmatch(script)[1], "payload-")
+			fmt.Fprintf(&out, "%d %d %d\n", size, transfer(base, size), latency)
+		}
+		return out.String(), "", nil
+	})
+}
+
+func TestPathMTU(t *testing.T) {
+	ctx := context.Background()
+	lost := "no reply within 2s"
+	var pinged []string
+	newEnv := func(executor check.Executor) *check.Env {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+			// mtu-server-... and mtu-client-... land on different nodes.
+			pod.Spec.NodeName = "node-" + strings.SplitN(pod.Name, "-", 3)[1]
+			return false, nil, nil
+		})
+		return &check.Env{Clientset: clientset, Executor: executor, Namespace: "default"}
+	}
+	run := func(env *check.Env) check.Result {
+		return check.Run(ctx, check.New("path-mtu", "networking", "", networking.TestPathMTU), env)
+	}
+
+	t.Run("Healthy", func(t *testing.T) {
+		var pinged []string
+		var bases []string
+		env := newEnv(fakePath(1450, &pinged,
+			func(size int) string { return "" },
+			func(base string, size int) int { bases = append(bases, base); return size }))
+
+		result := run(env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Equal(t, []string{"netperf", "ping", "--timeout", "2s", "10.0.0.1", "56", "512", "1024", "1372", "1422"}, pinged)
+		assert.Contains(t, bases, "http://10.0.0.1:8080/")
+		assert.Contains(t, bases, "http://10.96.0.10:80/")
+		assert.Contains(t, result.Message, "interface MTU 1450, DF pings up to 1422 bytes")
+		assert.Contains(t, result.Message, "pod IP: up to 4MiB")
+		assert.Contains(t, result.Message, "ClusterIP: up to 4MiB")
+		assert.NotContains(t, result.Message, "share node")
+		assert.Contains(t, result.Details, "4MiB")
+	})
+
+	t.Run("Blackhole", func(t *testing.T) {
+		env := newEnv(fakePath(1500, &pinged,
+			func(size int) string {
+				if size > 1400 {
+					return lost
+				}
+				return ""
+			},
+			func(base string, size int) int {
+				if size > 16<<10 {
+					return 0
+				}
+				return size
+			}))
+
+		result := run(env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "pings with up to 1372 bytes work but 1422 bytes are lost, so the path MTU is below the interface MTU 1500")
+		assert.Contains(t, result.Message, "pod IP: transfers up to 16KiB work but 64KiB fail, a likely fragmentation blackhole")
+		assert.Contains(t, result.Message, "ClusterIP: transfers up to 16KiB work but 64KiB fail")
+		assert.Contains(t, result.Details, "0 of 65536 bytes received")
+		assert.Contains(t, result.Details, "no reply within 2s")
+	})
+
+	t.Run("NoICMP", func(t *testing.T) {
+		env := newEnv(fakePath(1450, &pinged,
+			func(size int) string {
+				return "failed to open ICMP socket: permission denied\noperation not permitted"
+			},
+			func(base string, size int) int { return size }))
+
+		result := run(env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "ping not possible (no permission to send ICMP)")
+	})
+}
+
+// throughputCluster returns a clientset with the given ready nodes, plus a
+// tainted one, that places pods on the node their selector names.
+func throughputCluster(nodes ...string) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	for _, name := range append(nodes, "tainted") {
+		node := testNode(name, "192.168.0.1", "")
+		node.Labels = map[string]string{corev1.LabelHostname: name}
+		node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+		if name == "tainted" {
+			node.Spec.Taints = []corev1.Taint{{Key: "node-role.kubernetes.io/control-plane", Effect: corev1.TaintEffectNoSchedule}}
+		}
+		_, _ = clientset.CoreV1().Nodes().Create(context.Background(), node, metav1.CreateOptions{})
+	}
+	runningPods(clientset)
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Spec.NodeName = pod.Spec.NodeSelector[corev1.LabelHostname]
+		return false, nil, nil
+	})
+	return clientset
+}
+
+// fakeNetperf answers netperf client runs with bitsPerSecond for TCP and
+// 100 Mbit/s with loss percent lost for UDP, depending on whether the client
+// pod shares the server's node.
+func fakeNetperf(clientset *fake.Clientset, bitsPerSecond map[bool]float64, lost map[bool]int64) check.Executor {
+	return check.ExecFunc(func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+		if command[0] != "netperf" || command[1] != "client" {
+			return "", "unexpected command", utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code 1"), Code: 1}
+		}
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return "", "", err
+		}
+		nodes := map[string]string{}
+		var serverNode string
+		for _, p := range pods.Items {
+			nodes[p.Name] = p.Spec.NodeName
+			if p.Status.PodIP == command[2] {
+				serverNode = p.Spec.NodeName
+			}
+		}
+		sameNode := nodes[pod] == serverNode
+		if command[slices.Index(command, "--protocol")+1] == netperf.TCP {
+			return fmt.Sprintf(`{"protocol":"tcp","bytes":1,"seconds":10,"bitsPerSecond":%g,"retransmits":3}`, bitsPerSecond[sameNode]), "", nil
+		}
+		return fmt.Sprintf(`{"protocol":"udp","bytes":1,"seconds":10,"bitsPerSecond":1e8,"packets":%d,"lost":%d,"jitter":50000}`,
+			100-lost[sameNode], lost[sameNode]), "", nil
+	})
+}
+
+func TestPodThroughput(t *testing.T) {
+	ctx := context.Background()
+	run := func(env *check.Env) check.Result {
+		return check.Run(ctx, check.New("pod-throughput", "networking", "", networking.TestPodThroughput), env)
+	}
+
+	t.Run("SameAndCrossNode", func(t *testing.T) {
+		clientset := throughputCluster("node-a", "node-b")
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  fakeNetperf(clientset, map[bool]float64{true: 9.4e9, false: 2.1e9}, nil),
+			Namespace: "default",
+			Settings:  check.Settings{Image: "registry.example/netperf:v1"},
+			// Keep the pods to inspect them afterwards.
+			KeepResources: true,
+		}
+
+		result := run(env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "same-node tcp 9.40 Gbit/s, same-node udp jitter 50µs, 0.00% loss")
+		assert.Contains(t, result.Message, "cross-node tcp 2.10 Gbit/s")
+		assert.Contains(t, result.Details, "RETRANSMITS")
+
+		// Pods use the configured image and never land on the tainted node.
+		pods, err := clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, pods.Items, 3)
+		for _, pod := range pods.Items {
+			assert.Equal(t, "registry.example/netperf:v1", pod.Spec.Containers[0].Image)
+			assert.NotEqual(t, "tainted", pod.Spec.NodeName)
+		}
+	})
+
+	t.Run("Thresholds", func(t *testing.T) {
+		clientset := throughputCluster("node-a", "node-b")
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  fakeNetperf(clientset, map[bool]float64{true: 9.4e9, false: 0.8e9}, map[bool]int64{false: 3}),
+			Namespace: "default",
+			Settings:  check.Settings{Thresholds: performance.Thresholds{MinThroughput: 1, ErrorRate: 1}},
+		}
+
+		result := run(env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "throughput thresholds not met: cross-node tcp 0.80 Gbit/s < 1.00 Gbit/s, cross-node udp loss 3.00% > 1.00%")
+	})
+
+	t.Run("SingleNode", func(t *testing.T) {
+		clientset := throughputCluster("node-a")
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  fakeNetperf(clientset, map[bool]float64{true: 9.4e9}, nil),
+			Namespace: "default",
+		}
+
+		result := run(env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "only node node-a accepts pods, cross-node throughput not measured")
+		assert.NotContains(t, result.Message, "cross-node tcp")
+	})
+}
+
+// fakeProbe answers netperf probe runs, reaching every target but those in
+// unreachable.
+func fakeProbe(probed *[]string, unreachable map[string]string) check.Executor {
+	return check.ExecFunc(func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+		if command[0] != "netperf" || command[1] != "probe" {
+			return "", "unexpected command", utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code 1"), Code: 1}
+		}
+		var out strings.Builder
+		for _, target := range command[4:] {
+			*probed = append(*probed, target)
+			if reason, ok := unreachable[target]; ok {
+				fmt.Fprintf(&out, `{"target":%q,"reachable":false,"dns":1000000,"total":5000000000,"error":%q}`+"\n", target, reason)
+				continue
+			}
+			fmt.Fprintf(&out, `{"target":%q,"reachable":true,"dns":1000000,"connect":2000000,"tls":15000000,"total":20000000,"status":200}`+"\n", target)
+		}
+		return out.String(), "", nil
+	})
+}
+
+func TestEgress(t *testing.T) {
+	ctx := context.Background()
+	run := func(env *check.Env) check.Result {
+		return check.Run(ctx, check.New("egress", "networking", "", networking.TestEgress), env)
+	}
+
+	t.Run("StandIn", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var probed []string
+		env := &check.Env{Clientset: clientset, Executor: fakeProbe(&probed, nil), Namespace: "default", RunID: "run1"}
+
+		result := run(env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		require.Len(t, probed, 1)
+		assert.Regexp(t, `^http://egress-standin-run1-\w+\.default\.svc:80/$`, probed[0])
+		assert.Contains(t, result.Message, "no targets configured, probed in-cluster stand-in")
+		assert.Contains(t, result.Message, "1 of 1 targets reachable")
+		assert.Contains(t, result.Details, "reachable (200)")
+	})
+
+	t.Run("Targets", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		var probed []string
+		env := &check.Env{
+			Clientset: clientset,
+			Executor: fakeProbe(&probed, map[string]string{
+				"proxy.example.com:3128": "failed to connect: dial tcp 198.51.100.1:3128: i/o timeout",
+			}),
+			Namespace: "default",
+			Settings:  check.Settings{Targets: []string{"https://registry.k8s.io/", "proxy.example.com:3128"}},
+		}
+
+		result := run(env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Equal(t, []string{"https://registry.k8s.io/", "proxy.example.com:3128"}, probed)
+		assert.Contains(t, result.Message, "unreachable targets: proxy.example.com:3128 (failed to connect: dial tcp 198.51.100.1:3128: i/o timeout)")
+		assert.Contains(t, result.Message, "1 of 2 targets reachable")
+		assert.Regexp(t, `https://registry.k8s.io/\s+reachable \(200\)\s+1ms\s+2ms\s+15ms\s+20ms`, result.Details)
+		assert.Regexp(t, `proxy.example.com:3128\s+unreachable\s+1ms\s+-\s+-\s+5s`, result.Details)
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		clientEnv := func(clientset *fake.Clientset) []corev1.EnvVar {
+			pods, err := clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+			for _, pod := range pods.Items {
+				if strings.HasPrefix(pod.Name, "egress-client-") {
+					return pod.Spec.Containers[0].Env
+				}
+			}
+			t.Fatal("no egress client pod")
+			return nil
+		}
+		proxy := check.Proxy{HTTPS: "http://proxy.example.com:3128", NoProxy: "10.0.0.0/8"}
+
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		var probed []string
+		env := &check.Env{
+			Clientset:     clientset,
+			Executor:      fakeProbe(&probed, nil),
+			Namespace:     "default",
+			KeepResources: true,
+			Settings:      check.Settings{Targets: []string{"https://registry.k8s.io/"}, Proxy: proxy},
+		}
+		result := run(env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "URL targets sent through proxy http://proxy.example.com:3128")
+		assert.Equal(t, []corev1.EnvVar{
+			{Name: "HTTPS_PROXY", Value: "http://proxy.example.com:3128"},
+			{Name: "NO_PROXY", Value: "10.0.0.0/8"},
+		}, clientEnv(clientset))
+
+		// The in-cluster stand-in is reached directly.
+		clientset = fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		env = &check.Env{
+			Clientset:     clientset,
+			Executor:      fakeProbe(&probed, nil),
+			Namespace:     "default",
+			RunID:         "run1",
+			KeepResources: true,
+			Settings:      check.Settings{Proxy: proxy},
+		}
+		result = run(env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		noProxy := clientEnv(clientset)[1]
+		assert.Equal(t, "NO_PROXY", noProxy.Name)
+		assert.Regexp(t, `^10\.0\.0\.0/8,egress-standin-run1-\w+\.default\.svc$`, noProxy.Value)
+	})
+}
+
+// kubeProxy is a fake service proxy for pods placed by placePods. Broken
+// ignores session affinity and traffic policies, and noHairpin drops
+// requests a backend sends to itself through its service.
+type kubeProxy struct {
+	clientset *fake.Clientset
+	broken    bool
+	noHairpin bool
+	next      int
+	// requested records every URL requested.
+	requested []string
+}
+
+// placePods puts backend pods on nodes in turn and other pods on clientNode.
+func placePods(clientset *fake.Clientset, clientNode string, nodes ...string) {
+	var n int
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Spec.NodeName = clientNode
+		if strings.Contains(pod.Name, "backend") {
+			pod.Spec.NodeName = nodes[n%len(nodes)]
+			n++
+		}
+		return false, nil, nil
+	})
+}
+
+func (p *kubeProxy) executor() check.Executor {
+	return fakeWget(func(pod, url string) (string, string) {
+		ctx := context.Background()
+		p.requested = append(p.requested, url)
+		timeout := "wget: download timed out"
+		services, _ := p.clientset.CoreV1().Services("default").List(ctx, metav1.ListOptions{})
+		svc := services.Items[0]
+		backends, _ := p.clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{LabelSelector: "app"})
+		client, _ := p.clientset.CoreV1().Pods("default").Get(ctx, pod, metav1.GetOptions{})
+
+		// Nodes route to their own backends only under a Local policy. Like
+		// kube-proxy's detectLocalMode ClusterCIDR, node port requests from
+		// the pod network are cluster traffic and may reach any backend.
+		node := ""
+		if strings.Contains(url, svc.Spec.ClusterIP) {
+			if svc.Spec.InternalTrafficPolicy != nil && *svc.Spec.InternalTrafficPolicy == corev1.ServiceInternalTrafficPolicyLocal {
+				node = client.Spec.NodeName
+			}
+		} else if svc.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyLocal && client.Spec.HostNetwork {
+			nodes, _ := p.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+			for _, n := range nodes.Items {
+				if strings.Contains(url, n.Status.Addresses[0].Address+":") {
+					node = n.Name
+				}
+			}
+		}
+		var candidates []string
+		for _, backend := range backends.Items {
+			if p.broken || node == "" || backend.Spec.NodeName == node {
+				candidates = append(candidates, backend.Name)
+			}
+		}
+		if len(candidates) == 0 {
+			return "", timeout
+		}
+
+		p.next++
+		chosen := candidates[p.next%len(candidates)]
+		if svc.Spec.SessionAffinity == corev1.ServiceAffinityClientIP && !p.broken {
+			chosen = candidates[0]
+		}
+		if p.noHairpin && chosen == pod {
+			return "", timeout
+		}
+		return chosen, ""
+	})
+}
+
+func TestServiceBehaviour(t *testing.T) {
+	ctx := context.Background()
+	cluster := func(clientNode string, nodes ...string) *fake.Clientset {
+		clientset := fake.NewSimpleClientset(
+			testNode("node-a", "192.168.0.1", ""),
+			testNode("node-b", "192.168.0.2", ""),
+			testNode("node-c", "192.168.0.3", ""),
+		)
+		placePods(clientset, clientNode, nodes...)
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		return clientset
+	}
+	run := func(env *check.Env, name string, fn check.Func) check.Result {
+		return check.Run(ctx, check.New(name, "networking", "", fn), env)
+	}
+
+	t.Run("Hairpin", func(t *testing.T) {
+		clientset := cluster("node-a", "node-a", "node-b", "node-c")
+		env := &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset}).executor(), Namespace: "default"}
+		result := run(env, "service-hairpin", networking.TestServiceHairpin)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "reached itself through ClusterIP 10.96.0.10: 30 requests, spread 10/10/10")
+
+		clientset = cluster("node-a", "node-a", "node-b", "node-c")
+		env = &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset, noHairpin: true}).executor(), Namespace: "default"}
+		result = run(env, "service-hairpin", networking.TestServiceHairpin)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "10 of 30 requests failed")
+		assert.Contains(t, result.Message, "hairpin NAT may be disabled")
+	})
+
+	t.Run("SessionAffinity", func(t *testing.T) {
+		clientset := cluster("node-a", "node-a", "node-b", "node-c")
+		env := &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset}).executor(), Namespace: "default"}
+		result := run(env, "service-session-affinity", networking.TestServiceSessionAffinity)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Regexp(t, `30 requests from pod service-client-\w+ all answered by test-service-backend-\w+`, result.Message)
+
+		clientset = cluster("node-a", "node-a", "node-b", "node-c")
+		env = &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset, broken: true}).executor(), Namespace: "default"}
+		result = run(env, "service-session-affinity", networking.TestServiceSessionAffinity)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "sessionAffinity ClientIP not honoured: 30 requests from one pod were answered by test-service-backend-")
+	})
+
+	t.Run("InternalTrafficPolicy", func(t *testing.T) {
+		clientset := cluster("node-a", "node-a", "node-b", "node-c")
+		env := &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset}).executor(), Namespace: "default"}
+		result := run(env, "service-internal-traffic-policy", networking.TestServiceInternalTrafficPolicy)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Regexp(t, `10 requests from node node-a answered only by local backends test-service-backend-\w+$`, result.Message)
+
+		// No backend on the client's node: requests are dropped.
+		clientset = cluster("node-c", "node-a", "node-b")
+		env = &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset}).executor(), Namespace: "default"}
+		result = run(env, "service-internal-traffic-policy", networking.TestServiceInternalTrafficPolicy)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "no backend on client node node-c, requests were dropped")
+
+		clientset = cluster("node-a", "node-a", "node-b", "node-c")
+		env = &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset, broken: true}).executor(), Namespace: "default"}
+		result = run(env, "service-internal-traffic-policy", networking.TestServiceInternalTrafficPolicy)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Regexp(t, `request from node node-a was answered by backend test-service-backend-\w+ on node node-[bc], but internalTrafficPolicy is Local`, result.Message)
+	})
+
+	t.Run("ExternalTrafficPolicy", func(t *testing.T) {
+		// Backends on node-a and node-b; the client's node-a is not probed
+		// and node-c has no backend. The fake proxy only applies the policy
+		// to requests from hostNetwork pods.
+		clientset := cluster("node-a", "node-a", "node-b")
+		proxy := &kubeProxy{clientset: clientset}
+		env := &check.Env{Clientset: clientset, Executor: proxy.executor(), Namespace: "default"}
+		result := run(env, "service-external-traffic-policy", networking.TestServiceExternalTrafficPolicy)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "node port 30080 answered by local backends on 1 nodes and dropped on 1 nodes without one")
+		assert.NotContains(t, proxy.requested, "http://192.168.0.1:30080/")
+		assert.Contains(t, proxy.requested, "http://192.168.0.3:30080/")
+
+		clientset = cluster("node-a", "node-a", "node-b")
+		env = &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset, broken: true}).executor(), Namespace: "default"}
+		result = run(env, "service-external-traffic-policy", networking.TestServiceExternalTrafficPolicy)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "externalTrafficPolicy Local not honoured on node port 30080")
+		assert.Regexp(t, `node-c forwarded to backend test-service-backend-\w+ on node node-[ab]`, result.Message)
+
+		// Only the client's node is left to probe.
+		clientset = fake.NewSimpleClientset(testNode("node-a", "192.168.0.1", ""))
+		placePods(clientset, "node-a", "node-a")
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		env = &check.Env{Clientset: clientset, Executor: (&kubeProxy{clientset: clientset}).executor(), Namespace: "default"}
+		result = run(env, "service-external-traffic-policy", networking.TestServiceExternalTrafficPolicy)
+		assert.Equal(t, check.StatusSkipped, result.Status, result.Message)
+	})
+}
+
+// onHost puts every created pod on node-a with that node's IP as host IP,
+// and gives hostNetwork pods hostIP as pod IP. Register it before
+// runningPods so it runs after it.
+func onHost(clientset *fake.Clientset, hostIP string) {
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Spec.NodeName = "node-a"
+		pod.Status.HostIP = hostIP
+		if pod.Spec.HostNetwork {
+			pod.Status.PodIP = hostIP
+		}
+		return false, nil, nil
+	})
+}
+
+func TestHostNetworking(t *testing.T) {
+	ctx := context.Background()
+	cluster := func(hostIP string) *fake.Clientset {
+		clientset := fake.NewSimpleClientset(testNode("node-a", "192.168.0.1", ""), kubernetesService("10.96.0.1"))
+		onHost(clientset, hostIP)
+		runningPods(clientset)
+		return clientset
+	}
+	run := func(env *check.Env, name string, fn check.Func) check.Result {
+		return check.Run(ctx, check.New(name, "networking", "", fn), env)
+	}
+
+	t.Run("HostNetworkPod", func(t *testing.T) {
+		clientset := cluster("192.168.0.1")
+		var requested []string
+		env := &check.Env{Clientset: clientset, Namespace: "default", KeepResources: true,
+			Executor: fakeWget(func(pod, url string) (string, string) {
+				requested = append(requested, url)
+				return "node-a", ""
+			})}
+		result := run(env, "host-network-pod", networking.TestHostNetworkPod)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "hostNetwork pod on node node-a serves on node IP 192.168.0.1 port 19081")
+		assert.Equal(t, []string{"http://192.168.0.1:19081/"}, requested)
+		pods, err := clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		var hostNetwork int
+		for _, pod := range pods.Items {
+			if pod.Spec.HostNetwork {
+				hostNetwork++
+			}
+		}
+		assert.Equal(t, 1, hostNetwork)
+
+		env.Executor = fakeWget(func(pod, url string) (string, string) {
+			return "", "wget: can't connect to remote host: Connection refused"
+		})
+		result = run(env, "host-network-pod", networking.TestHostNetworkPod)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "regular pod could not reach hostNetwork pod on node node-a")
+
+		// The CNI gave the pod its own address.
+		env.Clientset = cluster("10.1.0.1")
+		result = run(env, "host-network-pod", networking.TestHostNetworkPod)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Regexp(t, `hostNetwork pod host-network-server-\w+ has IP 10.1.0.1, which is not an address of node node-a`, result.Message)
+	})
+
+	t.Run("HostPortPod", func(t *testing.T) {
+		clientset := cluster("192.168.0.1")
+		var requested []string
+		env := &check.Env{Clientset: clientset, Namespace: "default", KeepResources: true,
+			Executor: fakeWget(func(pod, url string) (string, string) {
+				requested = append(requested, url)
+				pods, _ := clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+				for _, p := range pods.Items {
+					if len(p.Spec.Containers[0].Ports) > 0 && p.Spec.Containers[0].Ports[0].HostPort == 19082 {
+						return p.Name, ""
+					}
+				}
+				return "", "wget: can't connect to remote host: Connection refused"
+			})}
+		result := run(env, "host-port-pod", networking.TestHostPortPod)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Regexp(t, `host port 19082 on node node-a IP 192.168.0.1 forwards to pod host-port-server-\w+`, result.Message)
+		assert.Equal(t, []string{"http://192.168.0.1:19082/"}, requested)
+
+		// Another process answers on the host port.
+		env.Executor = fakeWget(func(pod, url string) (string, string) { return "node-a", "" })
+		result = run(env, "host-port-pod", networking.TestHostPortPod)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Regexp(t, `host port 19082 on node node-a answered "node-a", expected pod host-port-server-\w+`, result.Message)
+	})
+
+	t.Run("PortTaken", func(t *testing.T) {
+		// status replaces the status of server pods after the other
+		// reactors have run.
+		taken := func(status corev1.PodStatus) *fake.Clientset {
+			clientset := fake.NewSimpleClientset(testNode("node-a", "192.168.0.1", ""))
+			clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+				if strings.Contains(pod.Name, "-server-") {
+					pod.Status = status
+				}
+				return false, nil, nil
+			})
+			onHost(clientset, "192.168.0.1")
+			runningPods(clientset)
+			return clientset
+		}
+
+		// Another process on the node holds the port.
+		env := &check.Env{Namespace: "default", Executor: fakeWget(func(pod, url string) (string, string) { return "node-a", "" })}
+		env.Clientset = taken(corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:                 "httpd",
+				State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Message: "httpd: bind: Address in use\n"}},
+			}},
+		})
+		result := run(env, "host-network-pod", networking.TestHostNetworkPod)
+		assert.Equal(t, check.StatusSkipped, result.Status, result.Message)
+		assert.Equal(t, "port 19081 is taken, possibly by a concurrent ktest run: httpd: bind: Address in use", result.Message)
+
+		// A concurrent run's pod holds the host port on every node.
+		env.Clientset = taken(corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{{
+				Type:    corev1.PodScheduled,
+				Status:  corev1.ConditionFalse,
+				Reason:  "Unschedulable",
+				Message: "0/1 nodes are available: 1 node(s) didn't have free ports for the requested pod ports.",
+			}},
+		})
+		result = run(env, "host-port-pod", networking.TestHostPortPod)
+		assert.Equal(t, check.StatusSkipped, result.Status, result.Message)
+		assert.Contains(t, result.Message, "port 19082 is taken, possibly by a concurrent ktest run: 0/1 nodes are available")
+	})
+
+	t.Run("HostNetworkDNS", func(t *testing.T) {
+		clientset := cluster("192.168.0.1")
+		env := &check.Env{Clientset: clientset, Executor: fakeNslookup(clusterDNS(t, clientset)), Namespace: "default", KeepResources: true}
+		result := run(env, "host-network-dns", networking.TestHostNetworkDNS)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "hostNetwork pod uses nameserver 10.96.0.10 and resolved kubernetes.default.svc.cluster.local")
+		pods, err := clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, pods.Items, 1)
+		assert.True(t, pods.Items[0].Spec.HostNetwork)
+		assert.Equal(t, corev1.DNSClusterFirstWithHostNet, pods.Items[0].Spec.DNSPolicy)
+
+		// The pod got the node's resolver.
+		env.Clientset = cluster("192.168.0.1")
+		env.Executor = check.ExecFunc(func(ctx context.Context, namespace, pod, container string, command []string) (string, string, error) {
+			return "search example.internal\nnameserver 192.168.0.254\n", "", nil
+		})
+		result = run(env, "host-network-dns", networking.TestHostNetworkDNS)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "hostNetwork pod with dnsPolicy ClusterFirstWithHostNet got the node's resolver: nameservers 192.168.0.254, search example.internal")
+	})
+}
+
+func TestNetworkingFunctions(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("TestDNS", func(t *testing.T) {
-		// With fake clientset and reactor, the function should complete successfully
-		err := networking.TestDNS(ctx, clientset, "default")
-		// Fake clientset allows pod creation and status checking to succeed
-		assert.NoError(t, err)
+		tests := map[string]struct {
+			answer string
+			status check.Status
+			detail string
+		}{
+			"matching answer": {
+				answer: "Name:\tkubernetes.default.svc.cluster.local\nAddress: 10.96.0.1\n",
+				status: check.StatusPassed,
+				detail: "kubernetes.default.svc.cluster.local A resolved to 10.96.0.1",
+			},
+			"wrong answer": {
+				answer: "Name:\tkubernetes.default.svc.cluster.local\nAddress: 10.96.0.99\n",
+				status: check.StatusFailed,
+				detail: "answered 10.96.0.99, expected 10.96.0.1; resolver output: Server: 10.96.0.10",
+			},
+			"no answer": {
+				answer: "** server can't find kubernetes.default.svc.cluster.local: NXDOMAIN\n",
+				status: check.StatusFailed,
+				detail: "A lookup of kubernetes.default.svc.cluster.local failed: Server: 10.96.0.10 Address: 10.96.0.10:53 ** server can't find",
+			},
+		}
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				clientset := fake.NewSimpleClientset(kubernetesService("10.96.0.1"))
+				runningPods(clientset)
+				var queried []string
+				env := &check.Env{
+					Clientset: clientset,
+					Executor: fakeNslookup(func(qtype, name string) string {
+						queried = append(queried, qtype+" "+name)
+						return tt.answer
+					}),
+					Namespace: "default",
+					Settings:  check.Settings{Timeout: 3 * time.Second},
+				}
+
+				result := check.Run(ctx, check.New("dns-resolution", "networking", "", networking.TestDNS), env)
+				assert.Equal(t, tt.status, result.Status, result.Message)
+				assert.Contains(t, result.Message, tt.detail)
+				assert.Contains(t, queried, "a kubernetes.default.svc.cluster.local")
+			})
+		}
 	})
 
 	t.Run("TestPodCreation", func(t *testing.T) {
-		err := networking.TestPodCreation(ctx, clientset, "default")
-		// Function should execute without panic - tests pod creation, not connectivity
-		assert.NoError(t, err)
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		var requested []string
+		env := &check.Env{
+			Clientset: clientset,
+			Executor: fakeWget(func(pod, url string) (string, string) {
+				requested = append(requested, url)
+				return "<html>welcome to nginx</html>", ""
+			}),
+			Namespace: "default",
+		}
+
+		result := check.Run(ctx, check.New("pod-to-pod", "networking", "", networking.TestPodCreation), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "http://10.0.0.1:80/ reachable in 1.5ms")
+		assert.Equal(t, []string{"http://10.0.0.1:80/"}, requested)
+	})
+
+	t.Run("TestPodCreationFailures", func(t *testing.T) {
+		tests := map[string]string{
+			"wget: download timed out": networking.ReasonTimeout,
+			"wget: can't connect to remote host (10.0.0.1): Connection refused": networking.ReasonRefused,
+			"wget: can't connect to remote host (10.0.0.1): No route to host":   networking.ReasonNoRoute,
+			"wget: server returned error: HTTP/1.1 500 Internal Server Error":   networking.ReasonFailed,
+		}
+		for stderr, reason := range tests {
+			clientset := fake.NewSimpleClientset()
+			runningPods(clientset)
+			env := &check.Env{
+				Clientset: clientset,
+				Executor: fakeWget(func(pod, url string) (string, string) {
+					return "", stderr
+				}),
+				Namespace: "default",
+			}
+
+			err := networking.TestPodCreation(ctx, env)
+			var probeErr *networking.ProbeError
+			require.ErrorAs(t, err, &probeErr, stderr)
+			assert.Equal(t, reason, probeErr.Reason, stderr)
+			assert.Contains(t, err.Error(), stderr)
+		}
+	})
+
+	t.Run("TestPodCreationWithoutExec", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		env := &check.Env{Clientset: clientset, Namespace: "default"}
+
+		err := networking.TestPodCreation(ctx, env)
+		require.Error(t, err)
+		var probeErr *networking.ProbeError
+		assert.NotErrorAs(t, err, &probeErr)
+	})
+
+	t.Run("TestPodCreationImagePullFailure", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+			pod.Status.Phase = corev1.PodPending
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+				Name:  pod.Spec.Containers[0].Name,
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+			}}
+			return false, nil, nil
+		})
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  fakeWget(func(pod, url string) (string, string) { return "", "" }),
+			Namespace: "default",
+			Settings:  check.Settings{Timeout: 10 * time.Second},
+		}
+
+		start := time.Now()
+		err := networking.TestPodCreation(ctx, env)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ImagePullBackOff")
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("TestNodeMatrix", func(t *testing.T) {
+		clientset := probePods(t, []string{"node-a", "node-b", "node-c"}, nil)
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  fakeWget(func(pod, url string) (string, string) { return "ok", "" }),
+			Namespace: "default",
+			RunID:     "run1",
+		}
+
+		result := check.Run(ctx, check.New("cross-node-connectivity", "networking", "", networking.TestNodeMatrix), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Equal(t, "3 nodes, 18 paths, slowest request 1.5ms", result.Message)
+		assert.Contains(t, result.Details, "[2] node-b")
+		assert.Contains(t, result.Details, "Pod network")
+		assert.Contains(t, result.Details, "Host network")
+		assert.NotContains(t, result.Details, "Failures:")
+	})
+
+	t.Run("TestNodeMatrixBrokenNode", func(t *testing.T) {
+		clientset := probePods(t, []string{"node-a", "node-b", "node-c"}, nil)
+		env := &check.Env{
+			Clientset: clientset,
+			// Nothing can reach pods on node-b.
+			Executor: fakeWget(func(pod, url string) (string, string) {
+				if strings.HasPrefix(url, "http://10.1.0.2:") {
+					return "", "wget: download timed out"
+				}
+				return "ok", ""
+			}),
+			Namespace: "default",
+			RunID:     "run1",
+		}
+
+		result := check.Run(ctx, check.New("cross-node-connectivity", "networking", "", networking.TestNodeMatrix), env)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Equal(t, "3 of 18 paths between 3 nodes failed; suspect nodes: node-b", result.Message)
+		assert.Contains(t, result.Details, "node-a -> node-b pod: http://10.1.0.2:8080/: timeout")
+		assert.Contains(t, result.Details, "X")
+	})
+
+	t.Run("TestNodeMatrixProbeNotReady", func(t *testing.T) {
+		run := func(clientset *fake.Clientset) check.Result {
+			env := &check.Env{
+				Clientset: clientset,
+				Executor:  fakeWget(func(pod, url string) (string, string) { return "ok", "" }),
+				Namespace: "default",
+				RunID:     "run1",
+				Settings:  check.Settings{Timeout: time.Second},
+			}
+			return check.Run(ctx, check.New("cross-node-connectivity", "networking", "", networking.TestNodeMatrix), env)
+		}
+
+		// A probe that cannot start does not hold up the others.
+		clientset := probePods(t, []string{"node-a", "node-b", "node-c"}, map[string]corev1.PodStatus{
+			"node-b": {
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "httpd",
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "pull denied"}},
+				}},
+			},
+		})
+		start := time.Now()
+		result := run(clientset)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Equal(t, "0 of 8 paths between 3 nodes failed, probes not ready on 1 nodes; suspect nodes: node-b", result.Message)
+		assert.Contains(t, result.Details, "[2] node-b")
+		assert.Contains(t, result.Details, "NR")
+		assert.Contains(t, result.Details, "node-b pod probe not ready: container httpd of pod netprobe-run1-")
+		assert.Contains(t, result.Details, "ImagePullBackOff: pull denied")
+
+		// A pending probe is waited for until the timeout.
+		clientset = probePods(t, []string{"node-a", "node-b", "node-c"}, map[string]corev1.PodStatus{
+			"node-c": {Phase: corev1.PodPending},
+		})
+		result = run(clientset)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Equal(t, "0 of 8 paths between 3 nodes failed, probes not ready on 1 nodes; suspect nodes: node-c", result.Message)
+		assert.Regexp(t, `node-c host probe not ready: pod netprobe-host-run1-\w+-node-c is Pending`, result.Details)
+
+		// No probe ready at all is still an error.
+		clientset = probePods(t, []string{"node-a"}, map[string]corev1.PodStatus{"node-a": {Phase: corev1.PodPending}})
+		result = run(clientset)
+		assert.Equal(t, check.StatusFailed, result.Status)
+		assert.Contains(t, result.Message, "has 0 of 1 pods ready")
 	})
 
 	t.Run("TestServiceConnectivity", func(t *testing.T) {
-		err := networking.TestServiceConnectivity(ctx, clientset, "default")
-		// Function should execute without panic
-		assert.NoError(t, err)
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{
+			Clientset: clientset,
+			Executor:  roundRobinBackends(clientset, &requested),
+			Namespace: "default",
+			RunID:     "run1",
+		}
+
+		result := check.Run(ctx, check.New("service-connectivity", "networking", "", networking.TestServiceConnectivity), env)
+		assert.Equal(t, check.StatusPassed, result.Status, result.Message)
+		assert.Contains(t, result.Message, "ClusterIP: 30 requests, spread 10/10/10")
+		assert.Contains(t, result.Message, "DNS name: 30 requests, spread 10/10/10")
+		assert.Contains(t, result.Message, "endpoints ready up to")
+		assert.Contains(t, requested, "http://10.96.0.10:80/")
+		assert.Regexp(t, `^http://test-service-run1-\w+\.default\.svc:80/$`, requested[len(requested)-1])
+	})
+
+	t.Run("TestServiceConnectivityUnevenBackends", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		// Only the first backend ever answers.
+		env := &check.Env{
+			Clientset: clientset,
+			Executor: fakeWget(func(pod, url string) (string, string) {
+				pods, _ := clientset.CoreV1().Pods("default").List(ctx, metav1.ListOptions{LabelSelector: "app"})
+				return pods.Items[0].Name, ""
+			}),
+			Namespace: "default",
+			Settings:  check.Settings{Replicas: 2},
+		}
+
+		err := networking.TestServiceConnectivity(ctx, env)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "ClusterIP http://10.96.0.10:80/: 20 requests never reached backends test-service-backend-")
 	})
 }
@@ -36,4 +36,27 @@ func TestLoadTestMetrics(t *testing.T) {
 		assert.Contains(t, report, "975")
 		assert.Contains(t, report, "25")
 	})
+
+	t.Run("NewMetrics", func(t *testing.T) {
+		var latencies []time.Duration
+		for i := 100; i >= 1; i-- {
+			latencies = append(latencies, time.Duration(i)*time.Millisecond)
+		}
+
+		metrics := performance.NewMetrics(10*time.Second, 100, 98, 2, latencies)
+		assert.Equal(t, 51*time.Millisecond, metrics.P50Latency)
+		assert.Equal(t, 96*time.Millisecond, metrics.P95Latency)
+		assert.Equal(t, 100*time.Millisecond, metrics.P99Latency)
+		assert.Equal(t, 2.0, metrics.ErrorRate)
+		assert.Equal(t, 10.0, metrics.Throughput)
+	})
+
+	t.Run("Exceeded", func(t *testing.T) {
+		metrics := &performance.Metrics{P95Latency: 80 * time.Millisecond, P99Latency: 5 * time.Second, ErrorRate: 0.5}
+
+		assert.Empty(t, metrics.Exceeded(performance.Thresholds{}))
+		assert.Empty(t, metrics.Exceeded(performance.Thresholds{P95Latency: 100 * time.Millisecond, ErrorRate: 1}))
+		assert.Equal(t, []string{"p99 latency 5s > 1s", "error rate 0.50% > 0.10%"},
+			metrics.Exceeded(performance.Thresholds{P99Latency: time.Second, ErrorRate: 0.1}))
+	})
 }
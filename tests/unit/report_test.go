@@ -1,11 +1,13 @@
 package unit
 
 import (
+	"encoding/xml"
 	"testing"
 	"time"
 
 	"github.com/denhamparry/kubernetes-testing/pkg/report"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestReportGeneration(t *testing.T) {
@@ -63,4 +65,147 @@ func TestReportGeneration(t *testing.T) {
 		assert.Contains(t, html, "Integration Test Report")
 		assert.Contains(t, html, "API Test")
 	})
+
+	t.Run("GenerateHTMLEscapesMessages", func(t *testing.T) {
+		r := report.NewTestReport("Operational")
+		r.AddResult(report.TestResult{
+			Name:    "dns-resolution",
+			Status:  "failed",
+			Message: "unexpected answer <nil>",
+		})
+		r.Complete()
+
+		html, err := r.GenerateHTML()
+		assert.NoError(t, err)
+		assert.Contains(t, html, "unexpected answer &lt;nil&gt;")
+		assert.NotContains(t, html, "<nil>")
+	})
+
+	t.Run("GenerateText", func(t *testing.T) {
+		r := report.NewTestReport("Operational")
+		r.AddResult(report.TestResult{Name: "deployment", Status: "passed", Duration: time.Second})
+		r.AddResult(report.TestResult{Name: "pvc-creation", Status: "failed", Message: "PVC is in Lost state"})
+		r.Complete()
+
+		text, err := r.GenerateText()
+		assert.NoError(t, err)
+		assert.Contains(t, text, "Operational Test Report")
+		assert.Contains(t, text, "✓ deployment (1s)")
+		assert.Contains(t, text, "✗ pvc-creation")
+		assert.Contains(t, text, "PVC is in Lost state")
+	})
+
+	t.Run("Render", func(t *testing.T) {
+		r := report.NewTestReport("Operational")
+		r.AddResult(report.TestResult{Name: "deployment", Category: "workload", Status: "passed"})
+		r.Complete()
+
+		for _, format := range report.Formats {
+			out, err := r.Render(format)
+			assert.NoError(t, err, format)
+			assert.Contains(t, out, "deployment", format)
+		}
+
+		jsonStr, err := r.Render("json")
+		assert.NoError(t, err)
+		assert.Contains(t, jsonStr, `"Category": "workload"`)
+
+		_, err = r.Render("yaml")
+		assert.Error(t, err)
+	})
+
+	t.Run("GenerateJUnit", func(t *testing.T) {
+		r := report.NewTestReport("Operational")
+		r.AddResult(report.TestResult{Name: "dns-resolution", Category: "networking", Status: "passed", Duration: 1500 * time.Millisecond})
+		r.AddResult(report.TestResult{Name: "pod-to-pod", Category: "networking", Status: "failed", Duration: 2 * time.Second, Message: "connection refused"})
+		r.AddResult(report.TestResult{Name: "pvc-creation", Category: "storage", Status: "skipped", Message: "disabled in config"})
+		r.Complete()
+
+		out, err := r.GenerateJUnit()
+		require.NoError(t, err)
+
+		var suites struct {
+			Tests    int `xml:"tests,attr"`
+			Failures int `xml:"failures,attr"`
+			Skipped  int `xml:"skipped,attr"`
+			Suites   []struct {
+				Name  string `xml:"name,attr"`
+				Tests int    `xml:"tests,attr"`
+				Time  string `xml:"time,attr"`
+				Cases []struct {
+					Name      string `xml:"name,attr"`
+					ClassName string `xml:"classname,attr"`
+					Time      string `xml:"time,attr"`
+					Failure   *struct {
+						Message string `xml:"message,attr"`
+						Body    string `xml:",chardata"`
+					} `xml:"failure"`
+					Skipped *struct {
+						Message string `xml:"message,attr"`
+					} `xml:"skipped"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		require.NoError(t, xml.Unmarshal([]byte(out), &suites))
+
+		assert.Equal(t, 3, suites.Tests)
+		assert.Equal(t, 1, suites.Failures)
+		assert.Equal(t, 1, suites.Skipped)
+		require.Len(t, suites.Suites, 2)
+
+		networking := suites.Suites[0]
+		assert.Equal(t, "networking", networking.Name)
+		assert.Equal(t, 2, networking.Tests)
+		assert.Equal(t, "3.500", networking.Time)
+		assert.Equal(t, "Operational.networking", networking.Cases[0].ClassName)
+		assert.Equal(t, "1.500", networking.Cases[0].Time)
+		assert.Nil(t, networking.Cases[0].Failure)
+		require.NotNil(t, networking.Cases[1].Failure)
+		assert.Equal(t, "connection refused", networking.Cases[1].Failure.Body)
+
+		storage := suites.Suites[1]
+		require.NotNil(t, storage.Cases[0].Skipped)
+		assert.Equal(t, "disabled in config", storage.Cases[0].Skipped.Message)
+	})
+
+	t.Run("Details", func(t *testing.T) {
+		r := report.NewTestReport("Operational")
+		r.AddResult(report.TestResult{
+			Name:     "cross-node-connectivity",
+			Category: "networking",
+			Status:   "failed",
+			Message:  "1 of 4 paths failed",
+			Details:  "Failures:\n  node-a -> node-b <timeout>\n",
+		})
+		r.Complete()
+
+		text, err := r.GenerateText()
+		require.NoError(t, err)
+		assert.Contains(t, text, "  1 of 4 paths failed\n    Failures:\n      node-a -> node-b <timeout>\n")
+
+		html, err := r.GenerateHTML()
+		require.NoError(t, err)
+		assert.Contains(t, html, "<pre>Failures:\n  node-a -&gt; node-b &lt;timeout&gt;\n</pre>")
+
+		out, err := r.GenerateJUnit()
+		require.NoError(t, err)
+		assert.Contains(t, out, "<system-out>Failures:&#xA;  node-a -&gt; node-b &lt;timeout&gt;&#xA;</system-out>")
+	})
+
+	t.Run("Interrupted", func(t *testing.T) {
+		r := report.NewTestReport("Operational")
+		r.AddResult(report.TestResult{Name: "pvc-creation", Category: "storage", Status: "interrupted", Message: "not started"})
+		r.Complete()
+		assert.Equal(t, 1, r.Interrupted)
+
+		text, err := r.GenerateText()
+		require.NoError(t, err)
+		assert.Contains(t, text, "Interrupted:  1")
+		assert.Contains(t, text, "! pvc-creation")
+
+		out, err := r.GenerateJUnit()
+		require.NoError(t, err)
+		assert.Contains(t, out, `errors="1"`)
+		assert.Contains(t, out, `<error message="interrupted">not started</error>`)
+	})
 }
@@ -0,0 +1,176 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/networking"
+	"github.com/denhamparry/kubernetes-testing/pkg/testrun"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRunNamespace(t *testing.T) {
+	t.Run("NewID", func(t *testing.T) {
+		id := testrun.NewID()
+		assert.Empty(t, validation.IsDNS1123Label(id))
+		assert.Empty(t, validation.IsValidLabelValue(id))
+		assert.NotEqual(t, id, testrun.NewID())
+	})
+
+	t.Run("CreateAndDelete", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		ctx := context.Background()
+
+		ns, err := testrun.CreateNamespace(ctx, clientset, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, "ktest-abc123", ns.Name)
+		assert.Equal(t, "ktest", ns.Labels[testrun.LabelManagedBy])
+		assert.Equal(t, "abc123", ns.Labels[testrun.LabelRunID])
+
+		require.NoError(t, testrun.DeleteNamespace(ctx, clientset, ns.Name, 10*time.Second))
+		_, err = clientset.CoreV1().Namespaces().Get(ctx, ns.Name, metav1.GetOptions{})
+		assert.True(t, apierrors.IsNotFound(err))
+
+		// Deleting a namespace that is already gone is not an error
+		assert.NoError(t, testrun.DeleteNamespace(ctx, clientset, ns.Name, 10*time.Second))
+	})
+}
+
+func labelledMeta(name, namespace, runID string, age time.Duration) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         namespace,
+		Labels:            testrun.Labels(runID),
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+	}
+}
+
+func resourceNames(resources []testrun.Resource) []string {
+	names := make([]string, 0, len(resources))
+	for _, r := range resources {
+		names = append(names, r.String())
+	}
+	return names
+}
+
+func TestFindLeaked(t *testing.T) {
+	ownedPod := &corev1.Pod{ObjectMeta: labelledMeta("test-deployment-abc-1", "default", "run1", time.Hour)}
+	ownedPod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "test-deployment-abc"}}
+
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: labelledMeta("ktest-run1", "", "run1", time.Hour)},
+		&corev1.Pod{ObjectMeta: labelledMeta("dns-test-a", "ktest-run1", "run1", time.Hour)},
+		&corev1.Pod{ObjectMeta: labelledMeta("dns-test-b", "default", "run1", time.Hour)},
+		ownedPod,
+		&appsv1.Deployment{ObjectMeta: labelledMeta("test-deployment-abc", "default", "run1", time.Hour)},
+		&appsv1.DaemonSet{ObjectMeta: labelledMeta("netprobe-abc", "default", "run1", time.Hour)},
+		&networkingv1.Ingress{ObjectMeta: labelledMeta("ktest-ingress-abc", "default", "run1", time.Hour)},
+		&corev1.Service{ObjectMeta: labelledMeta("test-service-c", "default", "run2", time.Minute)},
+		&corev1.PersistentVolumeClaim{ObjectMeta: labelledMeta("test-pvc-d", "other", "run3", 2*time.Hour)},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "default"}},
+	)
+	ctx := context.Background()
+
+	t.Run("ByRunID", func(t *testing.T) {
+		resources, err := testrun.FindLeaked(ctx, clientset, nil, testrun.Filter{RunID: "run1"})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{
+			"namespace ktest-run1",
+			"deployment default/test-deployment-abc",
+			"daemonset default/netprobe-abc",
+			"ingress default/ktest-ingress-abc",
+			"pod default/dns-test-b",
+		}, resourceNames(resources))
+	})
+
+	t.Run("OlderThan", func(t *testing.T) {
+		resources, err := testrun.FindLeaked(ctx, clientset, nil, testrun.Filter{OlderThan: 30 * time.Minute})
+		require.NoError(t, err)
+		names := resourceNames(resources)
+		assert.Contains(t, names, "PVC other/test-pvc-d")
+		assert.NotContains(t, names, "service default/test-service-c")
+	})
+
+	t.Run("Namespace", func(t *testing.T) {
+		resources, err := testrun.FindLeaked(ctx, clientset, nil, testrun.Filter{OlderThan: time.Second, Namespace: "other"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"PVC other/test-pvc-d"}, resourceNames(resources))
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		resources, err := testrun.FindLeaked(ctx, clientset, nil, testrun.Filter{RunID: "run2"})
+		require.NoError(t, err)
+		require.Len(t, resources, 1)
+		require.NoError(t, testrun.Delete(ctx, clientset, nil, resources[0]))
+
+		resources, err = testrun.FindLeaked(ctx, clientset, nil, testrun.Filter{RunID: "run2"})
+		require.NoError(t, err)
+		assert.Empty(t, resources)
+	})
+
+	t.Run("HTTPRoute", func(t *testing.T) {
+		httpRoutes := schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+		route := &unstructured.Unstructured{}
+		route.SetAPIVersion("gateway.networking.k8s.io/v1")
+		route.SetKind("HTTPRoute")
+		route.SetName("ktest-route-abc")
+		route.SetNamespace("default")
+		route.SetLabels(testrun.Labels("run5"))
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{httpRoutes: "HTTPRouteList"}, route)
+
+		resources, err := testrun.FindLeaked(ctx, clientset, dynamicClient, testrun.Filter{RunID: "run5"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"httproute default/ktest-route-abc"}, resourceNames(resources))
+		require.NoError(t, testrun.Delete(ctx, clientset, dynamicClient, resources[0]))
+		resources, err = testrun.FindLeaked(ctx, clientset, dynamicClient, testrun.Filter{RunID: "run5"})
+		require.NoError(t, err)
+		assert.Empty(t, resources)
+
+		// Without the Gateway API CRDs the kind is skipped.
+		dynamicClient.PrependReactor("list", "httproutes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewNotFound(httpRoutes.GroupResource(), "")
+		})
+		resources, err = testrun.FindLeaked(ctx, clientset, dynamicClient, testrun.Filter{RunID: "run1"})
+		require.NoError(t, err)
+		assert.Len(t, resources, 5)
+	})
+
+	t.Run("ChecksLabelObjects", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		runningPods(clientset)
+		serviceEndpoints(clientset)
+		var requested []string
+		env := &check.Env{
+			Clientset:     clientset,
+			Executor:      roundRobinBackends(clientset, &requested),
+			Namespace:     "default",
+			RunID:         "run4",
+			KeepResources: true,
+		}
+		require.NoError(t, networking.TestServiceConnectivity(ctx, env))
+
+		resources, err := testrun.FindLeaked(ctx, clientset, nil, testrun.Filter{RunID: "run4"})
+		require.NoError(t, err)
+		kinds := map[string]int{}
+		for _, r := range resources {
+			kinds[r.Kind]++
+		}
+		assert.Equal(t, map[string]int{"service": 1, "pod": 4}, kinds)
+	})
+}
@@ -0,0 +1,89 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denhamparry/kubernetes-testing/pkg/check"
+	"github.com/denhamparry/kubernetes-testing/pkg/testrun"
+	"github.com/denhamparry/kubernetes-testing/pkg/workload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// readyWorkloads makes every created deployment and statefulset report all of
+// its replicas as ready.
+func readyWorkloads(clientset *fake.Clientset) {
+	clientset.PrependReactor("create", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		dep := action.(k8stesting.CreateAction).GetObject().(*appsv1.Deployment)
+		dep.Status.ReadyReplicas = *dep.Spec.Replicas
+		return false, nil, nil
+	})
+	clientset.PrependReactor("create", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sts := action.(k8stesting.CreateAction).GetObject().(*appsv1.StatefulSet)
+		sts.Status.ReadyReplicas = *sts.Spec.Replicas
+		return false, nil, nil
+	})
+}
+
+func TestWorkloadFunctions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TestDeployment", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		readyWorkloads(clientset)
+		env := &check.Env{
+			Clientset:     clientset,
+			Namespace:     "default",
+			RunID:         "run1",
+			Settings:      check.Settings{Replicas: 3, Timeout: 5 * time.Second},
+			KeepResources: true,
+		}
+		require.NoError(t, workload.TestDeployment(ctx, env))
+
+		list, err := clientset.AppsV1().Deployments("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, list.Items, 1)
+		dep := list.Items[0]
+		assert.Contains(t, dep.Name, "run1")
+		assert.Equal(t, int32(3), *dep.Spec.Replicas)
+		assert.Equal(t, "run1", dep.Spec.Selector.MatchLabels[testrun.LabelRunID])
+		assert.Equal(t, "run1", dep.Spec.Template.Labels[testrun.LabelRunID])
+	})
+
+	t.Run("TestStatefulSet", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		readyWorkloads(clientset)
+		env := &check.Env{Clientset: clientset, Namespace: "default", RunID: "run2", KeepResources: true}
+		require.NoError(t, workload.TestStatefulSet(ctx, env))
+
+		list, err := clientset.AppsV1().StatefulSets("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, list.Items, 1)
+		sts := list.Items[0]
+		assert.Equal(t, int32(2), *sts.Spec.Replicas)
+		assert.Equal(t, sts.Name, sts.Spec.ServiceName)
+		assert.Equal(t, "run2", sts.Spec.Selector.MatchLabels[testrun.LabelRunID])
+	})
+
+	t.Run("ConcurrentRunsDoNotShareSelectors", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		readyWorkloads(clientset)
+		for _, runID := range []string{"run3", "run4"} {
+			env := &check.Env{Clientset: clientset, Namespace: "default", RunID: runID, KeepResources: true}
+			require.NoError(t, workload.TestDeployment(ctx, env))
+		}
+
+		list, err := clientset.AppsV1().Deployments("default").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		require.Len(t, list.Items, 2)
+		assert.NotEqual(t, list.Items[0].Name, list.Items[1].Name)
+		assert.NotEqual(t, list.Items[0].Spec.Selector.MatchLabels, list.Items[1].Spec.Selector.MatchLabels)
+	})
+}